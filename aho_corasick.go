@@ -0,0 +1,157 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import "bytes"
+
+// acNode is a state of an Aho-Corasick automaton.
+type acNode struct {
+	next map[byte]int
+	// fail is the state for the longest proper suffix of this state that is
+	// also a prefix of a needle.
+	fail int
+	// out is the index of the longest needle that ends in this state, or -1.
+	out int
+}
+
+// earliestMatcher fulfills the Matcher interface to match the first of many
+// strings to complete in the raw bytes read from Console's tty, using an
+// Aho-Corasick automaton so that each byte read is only processed once.
+type earliestMatcher struct {
+	needles []string
+	nodes   []acNode
+	state   int
+	// matched is the index of the needle that completed, or -1.
+	matched int
+}
+
+func newEarliestMatcher(needles []string) *earliestMatcher {
+	em := &earliestMatcher{
+		needles: needles,
+		nodes:   []acNode{{next: make(map[byte]int), out: -1}},
+		matched: -1,
+	}
+
+	for i, needle := range needles {
+		state := 0
+		for j := 0; j < len(needle); j++ {
+			next, ok := em.nodes[state].next[needle[j]]
+			if !ok {
+				next = len(em.nodes)
+				em.nodes = append(em.nodes, acNode{next: make(map[byte]int), out: -1})
+				em.nodes[state].next[needle[j]] = next
+			}
+			state = next
+		}
+		// The first of duplicate needles wins.
+		if em.nodes[state].out < 0 {
+			em.nodes[state].out = i
+		}
+	}
+
+	// Fail links are set in breadth-first order, so that the fail state of each
+	// state is known before those of its children.
+	var queue []int
+	for _, child := range em.nodes[0].next {
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		for b, child := range em.nodes[state].next {
+			em.nodes[child].fail = em.transition(em.nodes[state].fail, b)
+			if em.nodes[child].out < 0 {
+				em.nodes[child].out = em.nodes[em.nodes[child].fail].out
+			}
+			queue = append(queue, child)
+		}
+	}
+	return em
+}
+
+// transition returns the state after reading b in state.
+func (em *earliestMatcher) transition(state int, b byte) int {
+	for {
+		if next, ok := em.nodes[state].next[b]; ok {
+			return next
+		}
+		if state == 0 {
+			return 0
+		}
+		state = em.nodes[state].fail
+	}
+}
+
+func (em *earliestMatcher) Match(v interface{}) bool {
+	raw, ok := v.(RawBytes)
+	if !ok {
+		return false
+	}
+	if em.nodes[0].out >= 0 {
+		// An empty needle completes before any byte is read.
+		em.matched = em.nodes[0].out
+		return true
+	}
+
+	for _, b := range raw {
+		em.state = em.transition(em.state, b)
+		if out := em.nodes[em.state].out; out >= 0 {
+			em.matched = out
+			return true
+		}
+	}
+	return false
+}
+
+func (em *earliestMatcher) locate(buf []byte) []int {
+	if em.matched < 0 {
+		return nil
+	}
+	needle := em.needles[em.matched]
+	if !bytes.HasSuffix(buf, []byte(needle)) {
+		return nil
+	}
+	return []int{len(buf) - len(needle), len(buf)}
+}
+
+// Criteria returns the needle that completed once the matcher matched, and all
+// of the needles before.
+func (em *earliestMatcher) Criteria() interface{} {
+	if em.matched >= 0 {
+		return em.needles[em.matched]
+	}
+	return em.needles
+}
+
+// Earliest adds an Expect condition to exit as soon as any of the given strings
+// is read from Console's tty, meeting a single condition whose Criteria is the
+// string that completed. Unlike String, which evaluates each string over the
+// whole content read so far, the strings are found together with an
+// Aho-Corasick automaton in a time linear in the bytes read.
+//
+// The string that completes first in the stream wins. Of strings completing at
+// the same byte, such as "she" and "he" in "ushers", the longest one wins.
+// Strings are matched against the raw bytes read, ignoring changes made by
+// ReadMutators. Other conditions, such as Regexp, are evaluated separately as
+// each rune is read, so whichever condition is met first in the stream wins
+// too. When they are met by the same rune, conditions on the content read,
+// such as String or Regexp, win regardless of their order in opts, since they
+// are evaluated before conditions on raw bytes like Earliest.
+func Earliest(needles ...string) ExpectOpt {
+	return func(opts *ExpectOpts) error {
+		opts.Matchers = append(opts.Matchers, newEarliestMatcher(needles))
+		return nil
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// ErrAskpassUnsupported is returned by UseAskpass on platforms where the
+// helper script can't be run.
+var ErrAskpassUnsupported = errors.New("askpass is not supported on this platform")
+
+// askpassScript prints the content of the password file next to it, so that
+// the password itself never appears in a command line or environment.
+const askpassScript = `#!/bin/sh
+exec cat "$(dirname "$0")/password"
+`
+
+// askpass holds the environment that commands started by Console.Command get
+// while UseAskpass is in effect. It is shared by clones of a Console.
+type askpass struct {
+	mu  sync.Mutex
+	env []string
+}
+
+// environ returns the environment of commands, or nil to inherit the current
+// process's.
+func (a *askpass) environ() []string {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.env == nil {
+		return nil
+	}
+	return append(os.Environ(), a.env...)
+}
+
+func (a *askpass) set(env []string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.env = env
+}
+
+// UseAskpass makes programs started by Command, such as ssh, get password
+// from a generated SSH_ASKPASS helper rather than prompting for it on the tty,
+// which they read in a way that is hard to automate. The environment of the
+// commands gets SSH_ASKPASS pointing to the helper and SSH_ASKPASS_REQUIRE set
+// to force, so that OpenSSH 8.4 and later use it even though the command has
+// the tty as its controlling terminal. Older versions only use the helper when
+// they have no controlling terminal and DISPLAY is set, so DISPLAY is set if
+// it isn't already, and such commands should be started in a detached session
+// by setting SysProcAttr to Setsid alone.
+//
+// The password is written to a file only readable by the current user, in a
+// temporary directory with the helper. cleanup removes them and stops setting
+// the environment of new commands; it should be called once the password has
+// been read.
+func (c *Console) UseAskpass(password string) (cleanup func(), err error) {
+	if runtime.GOOS == "windows" || c.askpass == nil {
+		return nil, ErrAskpassUnsupported
+	}
+
+	dir, err := ioutil.TempDir("", "expect-askpass")
+	if err != nil {
+		return nil, err
+	}
+	cleanup = func() {
+		c.askpass.set(nil)
+		os.RemoveAll(dir)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "password"), []byte(password+"\n"), 0600)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "askpass"), []byte(askpassScript), 0700)
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	env := []string{
+		"SSH_ASKPASS=" + filepath.Join(dir, "askpass"),
+		"SSH_ASKPASS_REQUIRE=force",
+	}
+	if os.Getenv("DISPLAY") == "" {
+		env = append(env, "DISPLAY=:0")
+	}
+	c.askpass.set(env)
+	return cleanup, nil
+}
@@ -0,0 +1,64 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package expect
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUseAskpass(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found in PATH")
+	}
+
+	c, err := newTestConsole(t)
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	cleanup, err := c.UseAskpass("s3cret pass")
+	require.NoError(t, err)
+
+	// The helper is run the way ssh runs it, with the prompt as argument, as
+	// running ssh itself would need a server.
+	cmd := c.Command("sh", "-c", `test "$SSH_ASKPASS_REQUIRE" = force && echo "got $("$SSH_ASKPASS" "password: ")"`)
+	require.NoError(t, cmd.Start())
+	out, err := c.ExpectString("got s3cret pass\r\n")
+	require.NoError(t, err)
+	require.Equal(t, "got s3cret pass\r\n", out)
+	require.NoError(t, cmd.Wait())
+
+	var helper string
+	for _, env := range c.Command("true").Env {
+		if strings.HasPrefix(env, "SSH_ASKPASS=") {
+			helper = strings.TrimPrefix(env, "SSH_ASKPASS=")
+		}
+	}
+	require.NotEmpty(t, helper)
+
+	cleanup()
+	require.Nil(t, c.Command("true").Env)
+	_, err = os.Stat(helper)
+	require.True(t, os.IsNotExist(err), "expected the helper to be removed but got %v", err)
+}
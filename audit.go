@@ -0,0 +1,79 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// WithAuditLog records the dialog with Console's tty to w as one line per
+// successful Expect and per Send, for audit trails that don't need the rest
+// of the output, unlike WithTranscript. An Expect is recorded with the
+// criteria of the condition met and the text that met it, or all the content
+// read if the condition doesn't locate its matches, such as EOF. A Send is
+// recorded with what was sent, so secrets sent are recorded too unless they are
+// redacted with WithSendRedactor, which doesn't apply to their echo by the tty.
+// Each line starts with the time in RFC 3339 format, e.g.:
+//
+//	2018-06-01T12:00:00Z expect "Password:" matched "Password:"
+//	2018-06-01T12:00:00Z send "hunter2\n"
+//
+// Entries are recorded by a MatchObserver and a SendObserver, so Expects with
+// WithSilentObservers aren't recorded. Each entry is written with a single
+// call to w.Write, and errors writing are ignored.
+func WithAuditLog(w io.Writer) ConsoleOpt {
+	al := &auditLog{w: w}
+	return func(opts *ConsoleOpts) error {
+		opts.MatchObservers = append(opts.MatchObservers, al.expected)
+		opts.SendObservers = append(opts.SendObservers, al.sent)
+		return nil
+	}
+}
+
+// auditLog writes the entries of WithAuditLog.
+type auditLog struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (al *auditLog) expected(match *Match, err error) {
+	if err != nil || match.Matched == nil {
+		return
+	}
+	text := match.Buffer
+	if match.Start >= 0 {
+		text = match.Buffer[match.Start:match.End]
+	}
+	al.record("expect %q matched %q", match.Matched.Criteria(), text)
+}
+
+func (al *auditLog) sent(msg string, n int, err error) {
+	if err != nil {
+		al.record("send %q failed after %d bytes: %s", msg, n, err)
+		return
+	}
+	al.record("send %q", msg)
+}
+
+func (al *auditLog) record(format string, args ...interface{}) {
+	entry := time.Now().UTC().Format(time.RFC3339) + " " + fmt.Sprintf(format, args...) + "\n"
+
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	al.w.Write([]byte(entry))
+}
@@ -0,0 +1,58 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithAuditLog(t *testing.T) {
+	t.Parallel()
+
+	audit := new(lockedBuffer)
+	c, err := newTestConsole(t, WithAuditLog(audit))
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	_, err = c.Tty().WriteString("Loading modules... done\nWelcome!\nPassword: ")
+	require.NoError(t, err)
+
+	_, err = c.ExpectString("Password: ")
+	require.NoError(t, err)
+	_, err = c.SendLine("hunter2")
+	require.NoError(t, err)
+	_, err = c.ExpectString("hunter2")
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSuffix(audit.String(), "\n"), "\n")
+	require.Len(t, lines, 3)
+	entry := regexp.MustCompile(`^\d{4}-\d\d-\d\dT\d\d:\d\d:\d\dZ (.*)$`)
+	var entries []string
+	for _, line := range lines {
+		m := entry.FindStringSubmatch(line)
+		require.NotNil(t, m, "unexpected audit log entry %q", line)
+		entries = append(entries, m[1])
+	}
+	require.Equal(t, []string{
+		`expect "Password: " matched "Password: "`,
+		`send "hunter2\n"`,
+		`expect "hunter2" matched "hunter2"`,
+	}, entries)
+	require.NotContains(t, audit.String(), "Welcome")
+}
@@ -0,0 +1,164 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// defaultAutoRuleLimit is how many times an AutoRule may fire during a single
+// Expect unless it sets its own Limit.
+const defaultAutoRuleLimit = 3
+
+// ErrAutoRuleLimit is returned by Expect when an AutoRule fired more than its
+// limit, which usually means the program keeps repeating the prompt.
+var ErrAutoRuleLimit = errors.New("auto rule fired too many times")
+
+// AutoRule is a prompt that is answered automatically during any Expect, see
+// WithAutoResponder.
+type AutoRule struct {
+	// Match is the condition for the prompt, e.g. String("[y/N]").
+	Match ExpectOpt
+
+	// Response is sent to Console's tty when the prompt is read.
+	Response string
+
+	// Limit is how many times the rule may fire during a single Expect before
+	// the Expect fails with ErrAutoRuleLimit. Defaults to 3.
+	Limit int
+}
+
+// WithAutoResponder adds rules for prompts that Console answers by itself
+// while reading during any Expect, without returning to the caller, like
+// answering "Are you sure? [y/N]" with "y\n". Rules are evaluated in order
+// before the Expect's own conditions, and only against content read since
+// the last response, so that a prompt is answered once.
+func WithAutoResponder(rules []AutoRule) ConsoleOpt {
+	return func(opts *ConsoleOpts) error {
+		opts.AutoRules = append(opts.AutoRules, rules...)
+		return nil
+	}
+}
+
+// autoResponder tracks the AutoRules for a single Expect.
+type autoResponder struct {
+	rules  []*autoRule
+	offset int
+}
+
+type autoRule struct {
+	AutoRule
+	options ExpectOpts
+	fired   int
+}
+
+func newAutoResponder(rules []AutoRule) (*autoResponder, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	ar := new(autoResponder)
+	for _, rule := range rules {
+		var options ExpectOpts
+		if err := rule.Match(&options); err != nil {
+			return nil, err
+		}
+		if rule.Limit == 0 {
+			rule.Limit = defaultAutoRuleLimit
+		}
+		ar.rules = append(ar.rules, &autoRule{
+			AutoRule: rule,
+			options:  options,
+		})
+	}
+	return ar, nil
+}
+
+// respond sends the response of the first rule whose prompt is in the
+// content of buf read since the last response.
+func (ar *autoResponder) respond(c *Console, buf *bytes.Buffer) error {
+	if ar.offset > buf.Len() {
+		ar.offset = buf.Len()
+	}
+
+	unanswered := bytes.NewBuffer(buf.Bytes()[ar.offset:])
+	for _, rule := range ar.rules {
+		matcher := rule.options.Match(unanswered)
+		if matcher == nil {
+			continue
+		}
+
+		if rule.fired >= rule.Limit {
+			return fmt.Errorf("%w: %v fired %d times", ErrAutoRuleLimit, matcher.Criteria(), rule.fired)
+		}
+		rule.fired++
+		ar.offset = buf.Len()
+
+		c.Logf("auto responding to %v", matcher.Criteria())
+		_, err := c.Send(rule.Response)
+		return err
+	}
+	return nil
+}
+
+// pagerRuleLimit is how many times a pager rule may fire during a single
+// Expect, which bounds how many pages are advanced through.
+const pagerRuleLimit = 1000
+
+// PagerKeys are the keys sent to a pager by WithPagerKeys.
+type PagerKeys struct {
+	// Advance is sent to show the next page.
+	Advance string
+
+	// Quit is sent to leave the pager at the end of its content.
+	Quit string
+}
+
+// DefaultPagerKeys are the keys of WithPagerHandling, which advance and quit
+// both more and less.
+var DefaultPagerKeys = PagerKeys{Advance: " ", Quit: "q"}
+
+// WithPagerHandling answers the prompts of common pagers during any Expect, so
+// that the full output of a command piped through a pager is read rather than
+// stalling at the first page. It sends DefaultPagerKeys, see WithPagerKeys.
+func WithPagerHandling() ConsoleOpt {
+	return WithPagerKeys(DefaultPagerKeys)
+}
+
+// WithPagerKeys is like WithPagerHandling, but sends the given keys. The
+// Advance key is sent for the "--More--" prompt of more and the ":" prompt of
+// less at the start of a line, and the Quit key is sent for the "(END)" prompt
+// of less. Each prompt may be answered up to 1000 times during an Expect.
+func WithPagerKeys(keys PagerKeys) ConsoleOpt {
+	return WithAutoResponder([]AutoRule{
+		{
+			Match:    String("--More--"),
+			Response: keys.Advance,
+			Limit:    pagerRuleLimit,
+		},
+		{
+			Match:    String("(END)"),
+			Response: keys.Quit,
+			Limit:    pagerRuleLimit,
+		},
+		{
+			Match:    RegexpPattern(`(?:^|[\r\n]):$`),
+			Response: keys.Advance,
+			Limit:    pagerRuleLimit,
+		},
+	})
+}
@@ -0,0 +1,109 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"bufio"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var confirmRule = AutoRule{
+	Match:    String("[y/N]"),
+	Response: "y\n",
+}
+
+func TestWithAutoResponder(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t, WithAutoResponder([]AutoRule{confirmRule}))
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	answerC := make(chan string, 1)
+	go func() {
+		c.Tty().WriteString("Are you sure? [y/N] ")
+		answer, _ := bufio.NewReader(c.Tty()).ReadString('\n')
+		answerC <- answer
+		c.Tty().WriteString("Name: ")
+	}()
+
+	out, err := c.ExpectString("Name:")
+	require.NoError(t, err)
+	require.Equal(t, "y\n", <-answerC)
+	require.True(t, strings.HasPrefix(out, "Are you sure? [y/N] "))
+	require.True(t, strings.HasSuffix(out, "Name:"))
+}
+
+func TestWithAutoResponderLimit(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewTestConsole(t, WithAutoResponder([]AutoRule{confirmRule}), WithDefaultTimeout(5*time.Second))
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	// The program never accepts the answer and keeps asking.
+	go func() {
+		r := bufio.NewReader(c.Tty())
+		for {
+			_, err := c.Tty().WriteString("Are you sure? [y/N] ")
+			if err != nil {
+				return
+			}
+			_, err = r.ReadString('\n')
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	_, err = c.ExpectString("Name:")
+	require.True(t, errors.Is(err, ErrAutoRuleLimit), "unexpected error: %v", err)
+}
+
+func TestWithPagerKeys(t *testing.T) {
+	t.Parallel()
+
+	// The tty is in canonical mode, so the keys end with a newline for the
+	// pager to read them.
+	keys := PagerKeys{Advance: "\n", Quit: "q\n"}
+	c, err := newTestConsole(t, WithPagerKeys(keys))
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	keyC := make(chan string, 3)
+	go func() {
+		r := bufio.NewReader(c.Tty())
+		for _, page := range []string{"page 1\n--More--", "page 2\n:", "page 3\n(END)"} {
+			c.Tty().WriteString(page)
+			key, _ := r.ReadString('\n')
+			keyC <- key
+		}
+		c.Tty().WriteString("\n$ ")
+	}()
+
+	out, err := c.ExpectString("$ ")
+	require.NoError(t, err)
+	require.Contains(t, out, "page 1")
+	require.Contains(t, out, "page 2")
+	require.Contains(t, out, "page 3")
+	require.Equal(t, keys.Advance, <-keyC)
+	require.Equal(t, keys.Advance, <-keyC)
+	require.Equal(t, keys.Quit, <-keyC)
+}
@@ -0,0 +1,55 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"io"
+	"log"
+	"time"
+)
+
+// defaultBackpressureThreshold is how long content read from the ptm may wait
+// to be consumed before backpressure is reported.
+const defaultBackpressureThreshold = time.Second
+
+// backpressureReader reports when content read from its reader isn't consumed
+// for longer than threshold. Content is read from the ptm eagerly, so a long
+// gap between one Read returning and the next being called means that nothing
+// is consuming the output, and the child may block once the ptm's buffer
+// fills.
+type backpressureReader struct {
+	reader    io.Reader
+	threshold time.Duration
+	logger    *log.Logger
+	stats     *stats
+	returned  time.Time
+}
+
+func (br *backpressureReader) Read(p []byte) (int, error) {
+	if !br.returned.IsZero() {
+		if lag := time.Since(br.returned); lag >= br.threshold {
+			br.logger.Printf("possible ptm buffer backpressure: output was not consumed for %s", lag)
+			br.stats.backpressured()
+		}
+	}
+
+	n, err := br.reader.Read(p)
+	if n > 0 {
+		br.returned = time.Now()
+	} else {
+		br.returned = time.Time{}
+	}
+	return n, err
+}
@@ -0,0 +1,46 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrBufferSizeUnsupported is returned by SetBufferSize and BufferSize on
+// platforms where the size of Console's read buffer can't be changed.
+var ErrBufferSizeUnsupported = errors.New("buffer size is not supported on this platform")
+
+// SetBufferSize sets the capacity in bytes of the kernel pipe that holds the
+// output read from Console's tty until Expect consumes it. The pty's own
+// buffer has a size fixed by the kernel, but output is read from it eagerly
+// into this pipe, so a larger pipe lets a program write more before it blocks
+// on an Expect that isn't reading, see WithBackpressureThreshold. The kernel
+// may round n up; BufferSize returns the size in effect. Stats.Backpressure
+// tells whether a program still outpaces the Expects reading its output.
+//
+// Only Linux supports it, elsewhere ErrBufferSizeUnsupported is returned.
+func (c *Console) SetBufferSize(n int) error {
+	if n <= 0 {
+		return fmt.Errorf("invalid buffer size %d", n)
+	}
+	return setPipeSize(c.passthroughPipe.reader, n)
+}
+
+// BufferSize returns the capacity in bytes of the kernel pipe that holds the
+// output read from Console's tty, see SetBufferSize.
+func (c *Console) BufferSize() (int, error) {
+	return pipeSize(c.passthroughPipe.reader)
+}
@@ -0,0 +1,57 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"os"
+	"syscall"
+)
+
+// fcntl commands to set and get the capacity of a pipe, from fcntl(2).
+const (
+	fSetPipeSize = 1031
+	fGetPipeSize = 1032
+)
+
+// setPipeSize sets the capacity of pipe f to n bytes.
+func setPipeSize(f *os.File, n int) error {
+	_, err := pipeFcntl(f, fSetPipeSize, n)
+	return err
+}
+
+// pipeSize returns the capacity of pipe f in bytes.
+func pipeSize(f *os.File) (int, error) {
+	return pipeFcntl(f, fGetPipeSize, 0)
+}
+
+func pipeFcntl(f *os.File, cmd, arg int) (int, error) {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	var r uintptr
+	var errno syscall.Errno
+	err = rc.Control(func(fd uintptr) {
+		r, _, errno = syscall.Syscall(syscall.SYS_FCNTL, fd, uintptr(cmd), uintptr(arg))
+	})
+	if err != nil {
+		return 0, err
+	}
+	if errno != 0 {
+		return 0, os.NewSyscallError("fcntl", errno)
+	}
+	return int(r), nil
+}
@@ -0,0 +1,46 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetBufferSize(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewTestConsole(t)
+	require.NoError(t, err)
+	defer c.Close()
+
+	err = c.SetBufferSize(1 << 20)
+	if err != nil {
+		// Unprivileged users can't go above /proc/sys/fs/pipe-max-size.
+		t.Skipf("cannot raise buffer size: %s", err)
+	}
+
+	size, err := c.BufferSize()
+	require.NoError(t, err)
+	require.Equal(t, 1<<20, size)
+
+	require.NoError(t, c.SetBufferSize(4096))
+	size, err = c.BufferSize()
+	require.NoError(t, err)
+	require.Equal(t, 4096, size)
+
+	require.Error(t, c.SetBufferSize(0))
+}
@@ -0,0 +1,30 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+// +build !linux
+
+package expect
+
+import "os"
+
+// setPipeSize is unsupported, as only Linux can resize pipes.
+func setPipeSize(f *os.File, n int) error {
+	return ErrBufferSizeUnsupported
+}
+
+// pipeSize is unsupported, as only Linux can tell the size of pipes.
+func pipeSize(f *os.File) (int, error) {
+	return 0, ErrBufferSizeUnsupported
+}
@@ -0,0 +1,96 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// ConsoleChain is a pipeline of Consoles, where the program runs on the tty of
+// the first stage and each following stage relays the output of the previous
+// one to its own tty, so that Expect on the final stage matches the output end
+// to end. Input sent to the final stage is relayed back to the first.
+type ConsoleChain struct {
+	consoles []*Console
+}
+
+// Chain returns a ConsoleChain of consoles, ordered from the first stage, whose
+// tty the program runs on, to the final stage, which is expected from. Every
+// stage but the final one is read from by the chain, which drains its output
+// to the next stage until EOF, so Expect must only be called on the final
+// stage. The stages are owned by the chain and closed by its Close.
+func Chain(consoles ...*Console) (*ConsoleChain, error) {
+	if len(consoles) == 0 {
+		return nil, errors.New("chain has no consoles")
+	}
+
+	for i := 1; i < len(consoles); i++ {
+		prev, next := consoles[i-1], consoles[i]
+
+		// Output read from the previous stage is written to the next stage's
+		// tty. Draining it must not time out or notify the stage's observers.
+		relay := prev.With(WithStdout(next.Tty()), func(opts *ConsoleOpts) error {
+			opts.ReadTimeout = nil
+			return nil
+		})
+		go func() {
+			_, err := relay.Expect(EOF, PTSClosed, WithSilentObservers())
+			if err != nil && !prev.Closed() && !next.Closed() {
+				relay.Logf("failed to relay output: %s", err)
+			}
+		}()
+
+		// Input sent to the next stage is read from its tty and written to the
+		// previous stage.
+		go func() {
+			_, err := io.Copy(prev, next.Tty())
+			if err != nil && !prev.Closed() && !next.Closed() {
+				prev.Logf("failed to relay input: %s", err)
+			}
+		}()
+	}
+
+	return &ConsoleChain{consoles: consoles}, nil
+}
+
+// Tty returns the tty of the first stage, which the program runs on.
+func (cc *ConsoleChain) Tty() *os.File {
+	return cc.consoles[0].Tty()
+}
+
+// Console returns the final stage, whose Expect matches the output end to end.
+func (cc *ConsoleChain) Console() *Console {
+	return cc.consoles[len(cc.consoles)-1]
+}
+
+// Expect calls Expect on the final stage.
+func (cc *ConsoleChain) Expect(opts ...ExpectOpt) (string, error) {
+	return cc.Console().Expect(opts...)
+}
+
+// Close closes the stages in reverse order, from the final stage to the first,
+// so that input stops reaching earlier stages before they are closed. It
+// returns the first error from closing a stage.
+func (cc *ConsoleChain) Close() error {
+	var err error
+	for i := len(cc.consoles) - 1; i >= 0; i-- {
+		if cerr := cc.consoles[i].Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,56 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChain(t *testing.T) {
+	t.Parallel()
+
+	c1, err := newTestConsole(t)
+	require.NoError(t, err)
+	c2, err := newTestConsole(t)
+	require.NoError(t, err)
+
+	chain, err := Chain(c1, c2)
+	require.NoError(t, err)
+	defer testCloser(t, chain)
+
+	errC := make(chan error, 1)
+	go func() {
+		errC <- prompt(chain.Tty(), chain.Tty())
+	}()
+
+	_, err = chain.Expect(String("What is 1+1?"))
+	require.NoError(t, err)
+	_, err = chain.Console().SendLine("2")
+	require.NoError(t, err)
+
+	_, err = chain.Expect(String("What is Netflix backwards?"))
+	require.NoError(t, err)
+	_, err = chain.Console().SendLine("xilfteN")
+	require.NoError(t, err)
+
+	require.NoError(t, <-errC)
+}
+
+func TestChainEmpty(t *testing.T) {
+	_, err := Chain()
+	require.Error(t, err)
+}
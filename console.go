@@ -16,25 +16,49 @@ package expect
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 	"unicode/utf8"
 
 	"github.com/creack/pty"
 )
 
+// ErrClosed is returned when sending to or expecting from a Console that has
+// been closed.
+var ErrClosed = errors.New("console is closed")
+
+// mirrorPrefix marks mirrored sends in Console's stdouts.
+const mirrorPrefix = "> "
+
 // Console is an interface to automate input and output for interactive
 // applications. Console can block until a specified output is received and send
 // input back on it's tty. Console can also multiplex other sources of input
 // and multiplex its output to other writers.
 type Console struct {
+	ctx             context.Context
+	cancel          context.CancelFunc
 	opts            ConsoleOpts
 	ptm             *os.File
 	pts             *os.File
+	readerMux       *ReaderMux
+	screen          *screen
+	transcript      *transcript
+	stdout          *stdoutWriter
+	stats           *stats
+	inFlight        *inFlight
+	banner          *startupBanner
+	closing         *closeState
+	scrollback      *scrollback
+	askpass         *askpass
 	passthroughPipe *PassthroughPipe
 	runeReader      *bufio.Reader
 	closers         []io.Closer
@@ -47,19 +71,69 @@ type ConsoleOpt func(*ConsoleOpts) error
 type ConsoleOpts struct {
 	Logger          *log.Logger
 	Stdins          []io.Reader
+	ExtraFDs        []*os.File
 	Stdouts         []io.Writer
 	Closers         []io.Closer
 	ExpectObservers []ExpectObserver
+	MatchObservers  []MatchObserver
 	SendObservers   []SendObserver
 	ReadTimeout     *time.Duration
+	MirrorSends     bool
+	ReadMutators    []ReadMutator
+	ScreenRows      int
+	ScreenCols      int
+	Transcript      io.Writer
+	AutoRules       []AutoRule
+	ResizeHooks     []ResizeHook
+	StartupBanner   ExpectOpt
+	Scrollback      int
+	StrictDrain     bool
+
+	// IncompleteRunePolicy is what Expect does with a UTF-8 sequence cut
+	// short by EOF, see WithIncompleteRunePolicy.
+	IncompleteRunePolicy IncompleteRunePolicy
+
+	// StdoutErrorPolicy is what Console does when a writer in Stdouts
+	// returns an error.
+	StdoutErrorPolicy StdoutErrorPolicy
+
+	// AsyncStdout writes to Stdouts from a separate goroutine, see
+	// WithAsyncStdout.
+	AsyncStdout bool
+
+	// ErrorContextBytes is how many bytes at the end of the content read are
+	// included in the message of a TimeoutError. Zero includes all of it.
+	ErrorContextBytes int
+
+	// SendRedactor rewrites what is sent to Console's tty wherever it is
+	// logged or observed, see WithSendRedactor.
+	SendRedactor func(s string) string
+
+	// BackpressureThreshold is how long output read from the tty may go
+	// unconsumed before possible backpressure is logged. Zero disables it.
+	BackpressureThreshold time.Duration
+
+	// BufferWarnThreshold is how many bytes an Expect may read without
+	// matching before a warning is logged. Zero disables it.
+	BufferWarnThreshold int
+
+	// ReadLatency and WriteLatency are artificial delays of reads from and
+	// writes to the tty. The zero value adds no delay.
+	ReadLatency  Latency
+	WriteLatency Latency
+
+	// ReadRateLimit is the most bytes per second read from the tty. Zero
+	// doesn't limit reads.
+	ReadRateLimit int
 }
 
 // ExpectObserver provides an interface for a function callback that will
-// be called after each Expect operation.
+// be called after each Expect operation, whether it succeeded or not.
 // matchers will be the list of active matchers when an error occurred,
-//   or a list of matchers that matched `buf` when err is nil.
+// or a list of the matcher that matched `buf` when err is nil.
 // buf is the captured output that was matched against.
 // err is error that might have occurred. May be nil.
+// See MatchObserver for where the matcher matched on success.
 type ExpectObserver func(matchers []Matcher, buf string, err error)
 
 // SendObserver provides an interface for a function callback that will
@@ -75,7 +149,8 @@ type SendObserver func(msg string, num int, err error)
 // Each write is written to each listed writer, one at a time. Console is the
 // last writer, writing to it's internal buffer for matching expects.
 // If a listed writer returns an error, that overall write operation stops and
-// returns the error; it does not continue down the list.
+// returns the error; it does not continue down the list. See
+// WithStdoutErrorPolicy to drop failing writers instead.
 func WithStdout(writers ...io.Writer) ConsoleOpt {
 	return func(opts *ConsoleOpts) error {
 		opts.Stdouts = append(opts.Stdouts, writers...)
@@ -92,6 +167,21 @@ func WithStdin(readers ...io.Reader) ConsoleOpt {
 	}
 }
 
+// WithExtraFD adds files whose content is also read and matched by Expect, such
+// as the reading end of a pipe passed to a program in exec.Cmd.ExtraFiles for
+// tools that write structured output to a dedicated file descriptor. Content
+// read from f is written to Console's tty as it arrives, so it is merged into
+// the output of the tty and goes through its line discipline, e.g. "\n" is
+// read as "\r\n". The streams are interleaved in the order each chunk is read,
+// so a program's writes to different descriptors are only ordered if they
+// don't overlap in time. The files are closed along with Console.
+func WithExtraFD(files ...*os.File) ConsoleOpt {
+	return func(opts *ConsoleOpts) error {
+		opts.ExtraFDs = append(opts.ExtraFDs, files...)
+		return nil
+	}
+}
+
 // WithCloser adds closers that are closed in order when Console is closed.
 func WithCloser(closer ...io.Closer) ConsoleOpt {
 	return func(opts *ConsoleOpts) error {
@@ -117,6 +207,15 @@ func WithExpectObserver(observers ...ExpectObserver) ConsoleOpt {
 	}
 }
 
+// WithMatchObserver adds a MatchObserver to allow monitoring the outcome of
+// Expect operations, including which condition matched and where.
+func WithMatchObserver(observers ...MatchObserver) ConsoleOpt {
+	return func(opts *ConsoleOpts) error {
+		opts.MatchObservers = append(opts.MatchObservers, observers...)
+		return nil
+	}
+}
+
 // WithSendObserver adds a SendObserver to allow monitoring Send operations.
 func WithSendObserver(observers ...SendObserver) ConsoleOpt {
 	return func(opts *ConsoleOpts) error {
@@ -133,10 +232,194 @@ func WithDefaultTimeout(timeout time.Duration) ConsoleOpt {
 	}
 }
 
+// WithBufferWarnThreshold logs a warning once per Expect when it has read more
+// than n bytes without meeting a condition, with the criteria awaited and the
+// last bytes read, which usually means a condition that will never be met,
+// e.g. because of a typo, long before the timeout says so.
+func WithBufferWarnThreshold(n int) ConsoleOpt {
+	return func(opts *ConsoleOpts) error {
+		if n <= 0 {
+			return fmt.Errorf("invalid buffer warning threshold %d", n)
+		}
+		opts.BufferWarnThreshold = n
+		return nil
+	}
+}
+
+// defaultTimeout is the package default read timeout for new Consoles, set by
+// SetDefaultTimeout.
+var defaultTimeout struct {
+	sync.Mutex
+	timeout time.Duration
+}
+
+// SetDefaultTimeout sets a default read timeout during Expect statements for
+// all Consoles created from now on, as if WithDefaultTimeout was passed to
+// each. An explicit WithDefaultTimeout always takes precedence. A zero timeout
+// clears the package default. It is safe to call concurrently.
+func SetDefaultTimeout(timeout time.Duration) {
+	defaultTimeout.Lock()
+	defer defaultTimeout.Unlock()
+	defaultTimeout.timeout = timeout
+}
+
+// DefaultTimeout returns the package default read timeout set by
+// SetDefaultTimeout, or zero if there is none.
+func DefaultTimeout() time.Duration {
+	defaultTimeout.Lock()
+	defer defaultTimeout.Unlock()
+	return defaultTimeout.timeout
+}
+
+// WithMirrorSends writes each Send to the writers added by WithStdout, so
+// that a single log reads as a dialog even when the tty does not echo input.
+// Each mirrored line is prefixed with "> " to mark it as input.
+func WithMirrorSends() ConsoleOpt {
+	return func(opts *ConsoleOpts) error {
+		opts.MirrorSends = true
+		return nil
+	}
+}
+
+// WithSendRedactor rewrites what is sent with Send or Write, e.g. to replace a
+// password with "***", wherever it is logged: in the Console's log, transcript
+// and mirrored sends, and in the message passed to SendObservers such as
+// WithAuditLog's, along with the number of its bytes sent. The bytes written to
+// Console's tty are left unchanged, and so are Stats. Since the tty may echo
+// what is sent, the output read can still contain it unless echo is disabled.
+// Redactors added by several WithSendRedactor are applied in order.
+func WithSendRedactor(redact func(s string) string) ConsoleOpt {
+	return func(opts *ConsoleOpts) error {
+		if previous := opts.SendRedactor; previous != nil {
+			opts.SendRedactor = func(s string) string {
+				return redact(previous(s))
+			}
+			return nil
+		}
+		opts.SendRedactor = redact
+		return nil
+	}
+}
+
+// WithStrictDrain makes Close return a *DrainError if output from Console's
+// tty was never consumed by Expect or ReadN, so that strict tests fail when
+// they don't assert everything a program prints. Close waits briefly for
+// output still in flight, and must not be called while an Expect is running.
+func WithStrictDrain() ConsoleOpt {
+	return func(opts *ConsoleOpts) error {
+		opts.StrictDrain = true
+		return nil
+	}
+}
+
+// WithErrorContextBytes includes up to the last n bytes of the content read
+// by an Expect in the message of its TimeoutError, preceded by "..." if
+// content was left out, so that logs tell what was read without growing with
+// the output. The full content is still available as TimeoutError.Buffer. By
+// default the message includes all the content read.
+func WithErrorContextBytes(n int) ConsoleOpt {
+	return func(opts *ConsoleOpts) error {
+		if n <= 0 {
+			return fmt.Errorf("invalid error context size %d", n)
+		}
+		opts.ErrorContextBytes = n
+		return nil
+	}
+}
+
+// WithScreen maintains a terminal screen of the given size by interpreting
+// common ANSI/VT100 sequences in the output read from Console's tty. The
+// rendered screen is available from Screen and can be matched with
+// ExpectScreen. The tty's window size is set to match.
+func WithScreen(rows, cols int) ConsoleOpt {
+	return func(opts *ConsoleOpts) error {
+		if rows <= 0 || cols <= 0 {
+			return fmt.Errorf("invalid screen size %dx%d", rows, cols)
+		}
+		opts.ScreenRows = rows
+		opts.ScreenCols = cols
+		return nil
+	}
+}
+
+// WithBackpressureThreshold sets how long output read from Console's tty may go
+// unconsumed before Console logs possible ptm buffer backpressure, which
+// defaults to one second. Once the ptm's buffer fills, the program writing to
+// the tty blocks, which can look like a hang. Each occurrence is also counted
+// in Stats.Backpressure. A zero threshold disables the diagnostic.
+func WithBackpressureThreshold(threshold time.Duration) ConsoleOpt {
+	return func(opts *ConsoleOpts) error {
+		opts.BackpressureThreshold = threshold
+		return nil
+	}
+}
+
+// WithStartupBanner consumes the output up to and including the banner matched
+// by matcher, such as a license notice printed before the first prompt, at the
+// start of the first Expect, so that the first Expect only sees the output
+// after it. The banner is read with the same timeout as the first Expect.
+//
+// If the banner doesn't appear, the first Expect fails with the error from
+// reading it, e.g. a timeout, and returns the content read while waiting for
+// the banner. Either way the banner is only expected once, so later Expects
+// see all the output.
+func WithStartupBanner(matcher ExpectOpt) ConsoleOpt {
+	return func(opts *ConsoleOpts) error {
+		opts.StartupBanner = matcher
+		return nil
+	}
+}
+
+// startupBanner is the banner of WithStartupBanner that has yet to be
+// consumed. It is shared by a Console and its clones from With, so that the
+// banner is only consumed once.
+type startupBanner struct {
+	mu  sync.Mutex
+	opt ExpectOpt
+}
+
+// take returns the banner's condition the first time it is called, and nil
+// afterwards.
+func (sb *startupBanner) take() ExpectOpt {
+	if sb == nil {
+		return nil
+	}
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	opt := sb.opt
+	sb.opt = nil
+	return opt
+}
+
+// pending reports whether the banner has yet to be consumed.
+func (sb *startupBanner) pending() bool {
+	if sb == nil {
+		return false
+	}
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	return sb.opt != nil
+}
+
 // NewConsole returns a new Console with the given options.
 func NewConsole(opts ...ConsoleOpt) (*Console, error) {
+	return NewConsoleContext(context.Background(), opts...)
+}
+
+// NewConsoleContext returns a new Console with the given options whose
+// lifecycle is tied to ctx. When ctx is done the Console is closed, which
+// unblocks any in-flight Expect with ctx.Err() and lets the Console's
+// background goroutines exit.
+//
+// Calling Close explicitly is still required when ctx may outlive the Console;
+// closing the Console before ctx is done releases the goroutine watching ctx.
+func NewConsoleContext(ctx context.Context, opts ...ConsoleOpt) (*Console, error) {
 	options := ConsoleOpts{
-		Logger: log.New(ioutil.Discard, "", 0),
+		Logger:                log.New(ioutil.Discard, "", 0),
+		BackpressureThreshold: defaultBackpressureThreshold,
+	}
+	if timeout := DefaultTimeout(); timeout != 0 {
+		options.ReadTimeout = &timeout
 	}
 
 	for _, opt := range opts {
@@ -149,23 +432,87 @@ func NewConsole(opts ...ConsoleOpt) (*Console, error) {
 	if err != nil {
 		return nil, err
 	}
-	closers := append(options.Closers, pts, ptm)
+	closers := options.Closers[:len(options.Closers):len(options.Closers)]
+	for _, f := range options.ExtraFDs {
+		closers = append(closers, f)
+	}
+	closers = append(closers, pts, ptm)
 
-	passthroughPipe, err := NewPassthroughPipe(ptm)
+	st := new(stats)
+	var source io.Reader = ptm
+	var t *transcript
+	if options.Transcript != nil {
+		t = &transcript{w: options.Transcript, logger: options.Logger}
+		source = &transcriptReader{reader: ptm, transcript: t}
+	}
+	var sb *scrollback
+	if options.Scrollback > 0 {
+		sb = &scrollback{size: options.Scrollback}
+		source = io.TeeReader(source, sb)
+	}
+	if options.ReadLatency.Max > 0 {
+		source = &latencyReader{reader: source, latency: options.ReadLatency}
+	}
+	if options.ReadRateLimit > 0 {
+		source = newRateLimitReader(source, options.ReadRateLimit)
+	}
+	if options.BackpressureThreshold > 0 {
+		source = &backpressureReader{
+			reader:    source,
+			threshold: options.BackpressureThreshold,
+			logger:    options.Logger,
+			stats:     st,
+		}
+	}
+
+	readerMux := NewReaderMux(source)
+	passthroughPipe, err := NewPassthroughPipe(readerMux)
 	if err != nil {
 		return nil, err
 	}
 	closers = append(closers, passthroughPipe)
 
 	c := &Console{
+		ctx:             ctx,
 		opts:            options,
 		ptm:             ptm,
 		pts:             pts,
+		readerMux:       readerMux,
+		transcript:      t,
+		stdout:          newStdoutWriter(options),
+		stats:           st,
+		inFlight:        new(inFlight),
+		askpass:         new(askpass),
+		banner:          &startupBanner{opt: options.StartupBanner},
+		closing:         &closeState{done: make(chan struct{})},
+		scrollback:      sb,
 		passthroughPipe: passthroughPipe,
 		runeReader:      bufio.NewReaderSize(passthroughPipe, utf8.UTFMax),
 		closers:         closers,
 	}
 
+	var watchCtx context.Context
+	watchCtx, c.cancel = context.WithCancel(ctx)
+	if ctx.Done() != nil {
+		go func() {
+			<-watchCtx.Done()
+			// Only close if the parent context is done, otherwise Close has already
+			// been called explicitly.
+			if c.ctx.Err() != nil {
+				c.Close()
+			}
+		}()
+	}
+
+	if options.ScreenRows > 0 {
+		c.screen = newScreen(options.ScreenRows, options.ScreenCols)
+		err = setWinSize(pts, uint16(options.ScreenRows), uint16(options.ScreenCols))
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+
 	for _, stdin := range options.Stdins {
 		go func(stdin io.Reader) {
 			_, err := io.Copy(c, stdin)
@@ -175,9 +522,55 @@ func NewConsole(opts ...ConsoleOpt) (*Console, error) {
 		}(stdin)
 	}
 
+	for _, f := range options.ExtraFDs {
+		go func(f *os.File) {
+			_, err := io.Copy(pts, f)
+			if err != nil && !c.Closed() {
+				c.Logf("failed to copy extra fd %s: %s", f.Name(), err)
+			}
+		}(f)
+	}
+
 	return c, nil
 }
 
+// With returns a shallow clone of Console that shares its tty, but has opts
+// applied on top of a copy of its options, e.g. to add a stdout or observer
+// for a section of a session. Options are only read when they are used, such
+// as stdouts and observers during Expect or Send. Options that set up the tty
+// itself, such as WithStdin, WithExtraFD, WithCloser, WithScreen and
+// WithTranscript, have no effect. Options that fail to apply are logged and
+// skipped.
+//
+// The clone and Console read from the same tty, so Expect must not be called
+// on both concurrently. Closing either closes the tty of both.
+func (c *Console) With(opts ...ConsoleOpt) *Console {
+	clone := *c
+	clone.opts = c.opts.copy()
+	for _, opt := range opts {
+		if err := opt(&clone.opts); err != nil {
+			c.Logf("failed to apply console option: %s", err)
+		}
+	}
+	clone.stdout = newStdoutWriter(clone.opts)
+	return &clone
+}
+
+// copy returns a copy of ConsoleOpts whose slices can be appended to without
+// affecting the original.
+func (co ConsoleOpts) copy() ConsoleOpts {
+	co.Stdins = co.Stdins[:len(co.Stdins):len(co.Stdins)]
+	co.Stdouts = co.Stdouts[:len(co.Stdouts):len(co.Stdouts)]
+	co.Closers = co.Closers[:len(co.Closers):len(co.Closers)]
+	co.ExpectObservers = co.ExpectObservers[:len(co.ExpectObservers):len(co.ExpectObservers)]
+	co.MatchObservers = co.MatchObservers[:len(co.MatchObservers):len(co.MatchObservers)]
+	co.SendObservers = co.SendObservers[:len(co.SendObservers):len(co.SendObservers)]
+	co.ReadMutators = co.ReadMutators[:len(co.ReadMutators):len(co.ReadMutators)]
+	co.AutoRules = co.AutoRules[:len(co.AutoRules):len(co.AutoRules)]
+	co.ResizeHooks = co.ResizeHooks[:len(co.ResizeHooks):len(co.ResizeHooks)]
+	return co
+}
+
 // Tty returns Console's pts (slave part of a pty). A pseudoterminal, or pty is
 // a pair of psuedo-devices, one of which, the slave, emulates a real text
 // terminal device.
@@ -185,15 +578,41 @@ func (c *Console) Tty() *os.File {
 	return c.pts
 }
 
+// Monitor returns a read-only io.Reader that receives a copy of all bytes
+// read from Console's tty from now on, concurrently with Expect. Monitors never
+// take bytes away from Expect. Bytes are buffered until read, and once ctx is
+// cancelled or Console is closed, future Reads will return io.EOF.
+func (c *Console) Monitor(ctx context.Context) io.Reader {
+	return c.readerMux.NewReader(ctx)
+}
+
+// Screen returns the text on the screen maintained by WithScreen, one line per
+// row with trailing spaces removed. If Console has no screen, an empty string is
+// returned.
+func (c *Console) Screen() string {
+	if c.screen == nil {
+		return ""
+	}
+	return c.screen.String()
+}
+
 // Read reads bytes b from Console's tty.
 func (c *Console) Read(b []byte) (int, error) {
 	return c.ptm.Read(b)
 }
 
-// Write writes bytes b to Console's tty.
+// Write writes bytes b to Console's tty. If Console is closed, ErrClosed is
+// returned.
 func (c *Console) Write(b []byte) (int, error) {
-	c.Logf("console write: %q", b)
-	return c.ptm.Write(b)
+	if c.Closed() {
+		return 0, ErrClosed
+	}
+	c.Logf("console write: %q", c.redactSend(string(b)))
+	c.opts.WriteLatency.sleep()
+	n, err := c.ptm.Write(b)
+	c.stats.sent(n)
+	c.recordInput(string(b[:n]))
+	return n, err
 }
 
 // Fd returns Console's file descripting referencing the master part of its
@@ -202,27 +621,222 @@ func (c *Console) Fd() uintptr {
 	return c.ptm.Fd()
 }
 
+// closeState tracks the closing of a Console. It is shared by a Console and its
+// clones from With, which close the same tty.
+type closeState struct {
+	once   sync.Once
+	closed int32
+	done   chan struct{}
+}
+
+// interrupt is the character that the tty's line discipline turns into SIGINT
+// for its foreground process group, as typed with Ctrl-C.
+const interrupt = "\x03"
+
+// Shutdown stops the program on Console's tty and closes Console. It sends an
+// interrupt to the tty's foreground process group, as Ctrl-C does, and waits up
+// to grace for EOF, which is read once every program has closed the tty. The
+// program must have the tty as its controlling terminal to be interrupted, as
+// when started with Command or Spawn. Console is closed regardless, and an
+// error is returned if EOF wasn't read within grace.
+func (c *Console) Shutdown(grace time.Duration) error {
+	_, err := c.Send(interrupt)
+	if err == nil {
+		// Console's own end of the tty would otherwise keep EOF from being
+		// read.
+		c.Tty().Close()
+		_, err = c.Expect(EOF, PTSClosed, WithTimeout(grace))
+		if err != nil {
+			err = fmt.Errorf("program did not exit within %s of interrupt: %w", grace, err)
+		}
+	}
+
+	cerr := c.Close()
+	if err != nil {
+		return err
+	}
+	return cerr
+}
+
 // Close closes Console's tty. Calling Close will unblock Expect and ExpectEOF.
+// Once closed, Send and Expect return ErrClosed.
+//
+// Close is idempotent and safe to call concurrently: only the first call closes
+// the tty and returns the errors from closing it, if any. Later calls wait for
+// it to complete and return nil. Closers that were already closed, such as a
+// Tty closed by the caller, are not an error.
 func (c *Console) Close() error {
-	for _, fd := range c.closers {
-		err := fd.Close()
-		if err != nil {
-			c.Logf("failed to close: %s", err)
+	var err error
+	c.closing.once.Do(func() {
+		atomic.StoreInt32(&c.closing.closed, 1)
+		defer close(c.closing.done)
+
+		var errs closeErrors
+		if c.opts.StrictDrain {
+			if output := c.drain(); output != "" {
+				c.Logf("unconsumed output at close: %q", output)
+				errs = append(errs, &DrainError{Output: output})
+			}
+		}
+
+		c.cancel()
+		for _, fd := range c.closers {
+			cerr := fd.Close()
+			if cerr != nil && !errors.Is(cerr, os.ErrClosed) {
+				c.Logf("failed to close: %s", cerr)
+				errs = append(errs, cerr)
+			}
 		}
+		err = errs.err()
+	})
+	return err
+}
+
+// drainTimeout is how long Close waits for output from Console's tty when
+// WithStrictDrain is set.
+const drainTimeout = 50 * time.Millisecond
+
+// DrainError is returned by Close when WithStrictDrain is set and output from
+// Console's tty was never consumed.
+type DrainError struct {
+	Output string
+}
+
+func (e *DrainError) Error() string {
+	return fmt.Sprintf("unconsumed output at close: %q", e.Output)
+}
+
+// drain returns the output from Console's tty that wasn't read yet, waiting up
+// to drainTimeout for more to arrive.
+func (c *Console) drain() string {
+	err := c.setReadDeadline(time.Now().Add(drainTimeout))
+	if err != nil {
+		c.Logf("failed to set read deadline: %s", err)
+		return ""
 	}
-	return nil
+	b, _ := ioutil.ReadAll(c.runeReader)
+	return string(b)
 }
 
-// Send writes string s to Console's tty.
+// closeErrors are the errors from closing each of Console's closers.
+type closeErrors []error
+
+// err returns nil if there are no errors, the only error if there is one, and
+// the closeErrors otherwise.
+func (ce closeErrors) err() error {
+	switch len(ce) {
+	case 0:
+		return nil
+	case 1:
+		return ce[0]
+	default:
+		return ce
+	}
+}
+
+func (ce closeErrors) Error() string {
+	msgs := make([]string, len(ce))
+	for i, err := range ce {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the first error, so that errors.Is and errors.As see it.
+func (ce closeErrors) Unwrap() error {
+	return ce[0]
+}
+
+// Closed reports whether Close has been called on Console or any of its
+// clones.
+func (c *Console) Closed() bool {
+	return c.closing != nil && atomic.LoadInt32(&c.closing.closed) != 0
+}
+
+// Done returns a channel that is closed once Close has completed, e.g. to stop
+// goroutines that monitor the session.
+func (c *Console) Done() <-chan struct{} {
+	return c.closing.done
+}
+
+// Send writes string s to Console's tty. If Console is closed, ErrClosed is
+// returned without sending.
 func (c *Console) Send(s string) (int, error) {
-	c.Logf("console send: %q", s)
+	if c.Closed() {
+		return 0, ErrClosed
+	}
+	c.Logf("console send: %q", c.redactSend(s))
+	c.opts.WriteLatency.sleep()
 	n, err := c.ptm.WriteString(s)
-	for _, observer := range c.opts.SendObservers {
-		observer(s, n, err)
+	c.stats.sent(n)
+	c.recordInput(s[:n])
+	if len(c.opts.SendObservers) > 0 {
+		msg, num := s, n
+		if c.opts.SendRedactor != nil {
+			// The count is of the redacted message, so that it is consistent
+			// with msg.
+			msg = c.redactSend(s)
+			num = len(msg)
+			if n < len(s) {
+				num = len(c.redactSend(s[:n]))
+			}
+		}
+		for _, observer := range c.opts.SendObservers {
+			observer(msg, num, err)
+		}
+	}
+	if c.opts.MirrorSends {
+		c.mirrorSend(c.redactSend(s[:n]))
 	}
 	return n, err
 }
 
+// redactSend returns s as it is logged, see WithSendRedactor.
+func (c *Console) redactSend(s string) string {
+	if c.opts.SendRedactor == nil {
+		return s
+	}
+	return c.opts.SendRedactor(s)
+}
+
+// recordInput records content written to Console's tty in its transcript, if
+// any, once redacted.
+func (c *Console) recordInput(s string) {
+	if c.transcript != nil {
+		c.transcript.record(TranscriptInput, []byte(c.redactSend(s)))
+	}
+}
+
+// mirrorSend writes sent string s to Console's stdouts, prefixing each line to
+// mark it as input.
+func (c *Console) mirrorSend(s string) {
+	if len(c.opts.Stdouts) == 0 || len(s) == 0 {
+		return
+	}
+
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var mirrored strings.Builder
+	for _, line := range lines {
+		mirrored.WriteString(mirrorPrefix)
+		mirrored.WriteString(line)
+	}
+
+	_, err := io.WriteString(c.stdout, mirrored.String())
+	if err != nil {
+		c.Logf("failed to mirror send: %s", err)
+	}
+}
+
+// SendRunes writes runes rs to Console's tty encoded as UTF-8, like Send, and
+// returns the number of bytes written.
+func (c *Console) SendRunes(rs []rune) (int, error) {
+	return c.Send(string(rs))
+}
+
 // SendLine writes string s to Console's tty with a trailing newline.
 func (c *Console) SendLine(s string) (int, error) {
 	return c.Send(fmt.Sprintf("%s\n", s))
@@ -0,0 +1,578 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewConsoleContextCancel(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c, err := NewConsoleContext(ctx)
+	require.NoError(t, err)
+
+	errC := make(chan error, 1)
+	go func() {
+		_, err := c.ExpectString("never printed")
+		errC <- err
+	}()
+
+	cancel()
+
+	select {
+	case err = <-errC:
+		require.Equal(t, context.Canceled, err)
+	case <-time.After(time.Second):
+		t.Fatal("Expect was not unblocked by context cancellation")
+	}
+
+	// Expect on a cancelled Console returns immediately.
+	_, err = c.ExpectString("never printed")
+	require.Equal(t, context.Canceled, err)
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.LessOrEqual(t, runtime.NumGoroutine(), before)
+}
+
+func TestWithMirrorSends(t *testing.T) {
+	t.Parallel()
+
+	stdout := new(bytes.Buffer)
+	c, err := NewConsole(WithStdout(stdout), WithMirrorSends())
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	_, err = c.SendLine("hello")
+	require.NoError(t, err)
+	_, err = c.Send("multi\nline\n")
+	require.NoError(t, err)
+
+	// Nothing has been read from the tty, so the sends in stdout can only come
+	// from mirroring rather than from tty echo.
+	require.Equal(t, "> hello\n> multi\n> line\n", stdout.String())
+
+	line, err := bufio.NewReader(c.Tty()).ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "hello\n", line)
+}
+
+func TestSendRunes(t *testing.T) {
+	t.Parallel()
+
+	var sent []string
+	c, err := newTestConsole(t, WithSendObserver(func(msg string, num int, err error) {
+		sent = append(sent, msg)
+	}))
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	n, err := c.SendRunes([]rune{'c', 'a', 'f', '\u00e9', '\n'})
+	require.NoError(t, err)
+	require.Equal(t, 6, n)
+	require.Equal(t, []string{"caf\u00e9\n"}, sent)
+
+	line, err := bufio.NewReader(c.Tty()).ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "caf\u00e9\n", line)
+}
+
+func TestMonitor(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t)
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	monitor := c.Monitor(ctx)
+
+	_, err = c.Tty().WriteString("What is 1+1? ")
+	require.NoError(t, err)
+
+	out, err := c.ExpectString("What is 1+1?")
+	require.NoError(t, err)
+	require.Equal(t, "What is 1+1?", out)
+
+	p := make([]byte, len("What is 1+1? "))
+	_, err = io.ReadFull(monitor, p)
+	require.NoError(t, err)
+	require.Equal(t, "What is 1+1? ", string(p))
+
+	// The monitor did not steal the trailing space from Expect.
+	out, err = c.ExpectString(" ")
+	require.NoError(t, err)
+	require.Equal(t, " ", out)
+
+	cancel()
+	_, err = monitor.Read(p)
+	require.Equal(t, io.EOF, err)
+}
+
+// lockedBuffer is a bytes.Buffer that is safe for concurrent use.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (lb *lockedBuffer) Write(p []byte) (int, error) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	return lb.buf.Write(p)
+}
+
+func (lb *lockedBuffer) String() string {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	return lb.buf.String()
+}
+
+func TestWithBufferWarnThreshold(t *testing.T) {
+	t.Parallel()
+
+	logs := new(lockedBuffer)
+	c, err := newTestConsole(t, WithLogger(log.New(logs, "", 0)), WithBufferWarnThreshold(100))
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	_, err = c.Tty().WriteString(strings.Repeat("noise ", 50) + "done")
+	require.NoError(t, err)
+
+	_, err = c.ExpectString("done")
+	require.NoError(t, err)
+	require.Equal(t, 1, strings.Count(logs.String(), "warning: expect read 101 bytes without finding [\"done\"]"), logs.String())
+
+	_, err = NewConsole(WithBufferWarnThreshold(0))
+	require.Error(t, err)
+}
+
+func TestWithBackpressureThreshold(t *testing.T) {
+	t.Parallel()
+
+	logs := new(lockedBuffer)
+	c, err := NewConsole(
+		WithLogger(log.New(logs, "", 0)),
+		WithBackpressureThreshold(50*time.Millisecond),
+		WithDefaultTimeout(5*time.Second),
+	)
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	// Produce more output than the buffers between the tty and Expect can hold,
+	// so that the producer is blocked until Expect consumes it.
+	errC := make(chan error, 1)
+	go func() {
+		_, err := c.Tty().WriteString(strings.Repeat("x", 128*1024))
+		c.Tty().Close()
+		errC <- err
+	}()
+
+	time.Sleep(200 * time.Millisecond)
+	out, err := c.ExpectEOF()
+	require.NoError(t, err)
+	require.NoError(t, <-errC)
+	require.Len(t, out, 128*1024)
+
+	require.Contains(t, logs.String(), "possible ptm buffer backpressure")
+	require.NotZero(t, c.Stats().Backpressure)
+}
+
+func TestWithExpectObserver(t *testing.T) {
+	t.Parallel()
+
+	type call struct {
+		matchers []Matcher
+		buf      string
+		err      error
+	}
+	var calls []call
+	c, err := NewTestConsole(t, WithExpectObserver(func(matchers []Matcher, buf string, err error) {
+		calls = append(calls, call{matchers, buf, err})
+	}))
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	_, err = c.Tty().WriteString("Hello world")
+	require.NoError(t, err)
+
+	_, err = c.Expect(String("never printed"), String("Hello"))
+	require.NoError(t, err)
+	_, err = c.Expect(String("never printed"), WithTimeout(10*time.Millisecond))
+	require.Error(t, err)
+
+	require.Len(t, calls, 2)
+
+	// On success, only the matcher that was met is passed.
+	require.NoError(t, calls[0].err)
+	require.Equal(t, "Hello", calls[0].buf)
+	require.Len(t, calls[0].matchers, 1)
+	require.Equal(t, "Hello", calls[0].matchers[0].Criteria())
+
+	require.Error(t, calls[1].err)
+	require.Equal(t, " world", calls[1].buf)
+	require.Len(t, calls[1].matchers, 1)
+	require.Equal(t, "never printed", calls[1].matchers[0].Criteria())
+}
+
+func TestWithMatchObserver(t *testing.T) {
+	t.Parallel()
+
+	var matches []*Match
+	c, err := newTestConsole(t, WithMatchObserver(func(match *Match, err error) {
+		require.NoError(t, err)
+		matches = append(matches, match)
+	}))
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	_, err = c.Tty().WriteString("What is 1+2? Answer:")
+	require.NoError(t, err)
+
+	re := regexp.MustCompile(`(\d)\+(\d)`)
+	_, err = c.Expect(String("never printed"), Regexp(re))
+	require.NoError(t, err)
+	_, err = c.ExpectString("Answer")
+	require.NoError(t, err)
+
+	require.Len(t, matches, 2)
+
+	match := matches[0]
+	require.Equal(t, "What is 1+2", match.Buffer)
+	require.Equal(t, re, match.Matched.Criteria())
+	require.Equal(t, 8, match.Start)
+	require.Equal(t, 11, match.End)
+	require.Equal(t, []string{"1+2", "1", "2"}, match.Groups)
+
+	match = matches[1]
+	require.Equal(t, "? Answer", match.Buffer)
+	require.Equal(t, "Answer", match.Matched.Criteria())
+	require.Equal(t, 2, match.Start)
+	require.Equal(t, 8, match.End)
+	require.Equal(t, []string{"Answer"}, match.Groups)
+}
+
+func TestWithSilentObservers(t *testing.T) {
+	t.Parallel()
+
+	var expects, matches int
+	c, err := NewTestConsole(t,
+		WithExpectObserver(func(matchers []Matcher, buf string, err error) {
+			expects++
+		}),
+		WithMatchObserver(func(match *Match, err error) {
+			matches++
+		}),
+	)
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	_, err = c.Tty().WriteString("first second")
+	require.NoError(t, err)
+
+	_, err = c.Expect(String("first"), WithSilentObservers())
+	require.NoError(t, err)
+	require.Equal(t, 0, expects)
+	require.Equal(t, 0, matches)
+
+	_, err = c.ExpectString("second")
+	require.NoError(t, err)
+	require.Equal(t, 1, expects)
+	require.Equal(t, 1, matches)
+}
+
+func TestWith(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t)
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	verbose := new(bytes.Buffer)
+	clone := c.With(WithStdout(verbose))
+
+	_, err = c.Tty().WriteString("Hello world")
+	require.NoError(t, err)
+
+	out, err := clone.ExpectString("Hello")
+	require.NoError(t, err)
+	require.Equal(t, "Hello", out)
+
+	// The clone shares the tty, so the rest is read by Console, whose stdouts
+	// are unaffected by the clone.
+	out, err = c.ExpectString("world")
+	require.NoError(t, err)
+	require.Equal(t, " world", out)
+	require.Equal(t, "Hello", verbose.String())
+	require.Len(t, c.opts.Stdouts, 1)
+}
+
+// errWriter is an io.Writer that always fails.
+type errWriter struct {
+	err error
+}
+
+func (ew errWriter) Write(p []byte) (int, error) {
+	return 0, ew.err
+}
+
+func TestWithStdoutErrorPolicy(t *testing.T) {
+	t.Parallel()
+
+	failing := errWriter{os.ErrClosed}
+
+	good := new(bytes.Buffer)
+	c, err := NewConsole(WithStdout(failing, good), WithStdoutErrorPolicy(StdoutErrorDrop), WithDefaultTimeout(time.Second))
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	_, err = c.Tty().WriteString("Hello world")
+	require.NoError(t, err)
+	out, err := c.ExpectString("world")
+	require.NoError(t, err)
+	require.Equal(t, "Hello world", out)
+	require.Equal(t, "Hello world", good.String())
+
+	// By default, the failing stdout aborts the Expect.
+	strict, err := NewConsole(WithStdout(failing), WithDefaultTimeout(time.Second))
+	require.NoError(t, err)
+	defer testCloser(t, strict)
+
+	_, err = strict.Tty().WriteString("Hello world")
+	require.NoError(t, err)
+	_, err = strict.ExpectString("world")
+	require.Equal(t, os.ErrClosed, err)
+}
+
+func TestSetDefaultTimeout(t *testing.T) {
+	// Not parallel, as the package default affects every new Console.
+	prev := DefaultTimeout()
+	defer SetDefaultTimeout(prev)
+
+	SetDefaultTimeout(100 * time.Millisecond)
+	require.Equal(t, 100*time.Millisecond, DefaultTimeout())
+
+	c, err := NewConsole()
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	start := time.Now()
+	_, err = c.ExpectString("never printed")
+	elapsed := time.Since(start)
+	require.True(t, os.IsTimeout(err), "expected a timeout but got %v", err)
+	require.True(t, elapsed >= 100*time.Millisecond && elapsed < time.Second, "timed out after %s", elapsed)
+
+	// An explicit option takes precedence.
+	explicit, err := NewConsole(WithDefaultTimeout(10 * time.Millisecond))
+	require.NoError(t, err)
+	defer testCloser(t, explicit)
+
+	start = time.Now()
+	_, err = explicit.ExpectString("never printed")
+	require.True(t, os.IsTimeout(err), "expected a timeout but got %v", err)
+	require.True(t, time.Since(start) < 100*time.Millisecond, "timed out after %s", time.Since(start))
+}
+
+func TestWithStartupBanner(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t, WithStartupBanner(String("All rights reserved.")))
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	_, err = c.Tty().WriteString("Tool v1.0\nAll rights reserved.\n$ ")
+	require.NoError(t, err)
+
+	out, err := c.ExpectString("$ ")
+	require.NoError(t, err)
+	require.Equal(t, "\r\n$ ", out)
+}
+
+func TestWithStartupBannerStats(t *testing.T) {
+	t.Parallel()
+
+	var observed int32
+	observer := func(matchers []Matcher, buf string, err error) {
+		atomic.AddInt32(&observed, 1)
+	}
+	c, err := newTestConsole(t, WithStartupBanner(String("All rights reserved.")), WithExpectObserver(observer))
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	_, err = c.Tty().WriteString("Tool v1.0\nAll rights reserved.\n$ ")
+	require.NoError(t, err)
+
+	_, err = c.ExpectString("$ ")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), c.Stats().ExpectCalls)
+	require.Equal(t, int32(1), atomic.LoadInt32(&observed))
+}
+
+func TestWithStartupBannerMissing(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewTestConsole(t, WithStartupBanner(String("All rights reserved.")), WithDefaultTimeout(50*time.Millisecond))
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	_, err = c.Tty().WriteString("$ ")
+	require.NoError(t, err)
+
+	out, err := c.ExpectString("$ ")
+	require.True(t, os.IsTimeout(err), "unexpected error: %v", err)
+	require.Equal(t, "$ ", out)
+
+	// The banner is only expected once.
+	_, err = c.Tty().WriteString("$ ")
+	require.NoError(t, err)
+
+	out, err = c.ExpectString("$ ")
+	require.NoError(t, err)
+	require.Equal(t, "$ ", out)
+}
+
+func TestClosed(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewTestConsole(t)
+	require.NoError(t, err)
+	testCloser(t, c)
+
+	_, err = c.Send("hello")
+	require.True(t, errors.Is(err, ErrClosed), "unexpected error: %v", err)
+
+	_, err = c.SendLine("hello")
+	require.True(t, errors.Is(err, ErrClosed), "unexpected error: %v", err)
+
+	_, err = c.ExpectString("hello")
+	require.True(t, errors.Is(err, ErrClosed), "unexpected error: %v", err)
+
+	// Clones share the tty, so they are closed too.
+	_, err = c.With().ExpectEOF()
+	require.True(t, errors.Is(err, ErrClosed), "unexpected error: %v", err)
+}
+
+func TestDone(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewTestConsole(t)
+	require.NoError(t, err)
+	require.False(t, c.Closed())
+
+	select {
+	case <-c.Done():
+		t.Fatal("Done was closed before Close")
+	default:
+	}
+
+	require.NoError(t, c.Close())
+	require.True(t, c.Closed())
+
+	select {
+	case <-c.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Done was not closed after Close")
+	}
+
+	// A second Close is a no-op.
+	require.NoError(t, c.Close())
+}
+
+// errCloser is an io.Closer that always fails.
+type errCloser struct {
+	err error
+}
+
+func (ec errCloser) Close() error {
+	return ec.err
+}
+
+func TestCloseConcurrently(t *testing.T) {
+	t.Parallel()
+
+	errClose := errors.New("close failed")
+	c, err := NewTestConsole(t, WithCloser(errCloser{errClose}))
+	require.NoError(t, err)
+
+	// The tty is often closed by the caller before Console is.
+	require.NoError(t, c.Tty().Close())
+
+	errC := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			errC <- c.Close()
+		}()
+	}
+
+	var errs []error
+	for i := 0; i < 2; i++ {
+		if err := <-errC; err != nil {
+			errs = append(errs, err)
+		}
+	}
+	require.Len(t, errs, 1)
+	require.True(t, errors.Is(errs[0], errClose), "unexpected error: %v", errs[0])
+}
+
+func TestWithStrictDrain(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewTestConsole(t, WithStrictDrain())
+	require.NoError(t, err)
+
+	_, err = c.Tty().WriteString("prompt> leftover")
+	require.NoError(t, err)
+	_, err = c.ExpectString("prompt> ")
+	require.NoError(t, err)
+
+	err = c.Close()
+	var drainErr *DrainError
+	require.True(t, errors.As(err, &drainErr), "unexpected error: %v", err)
+	require.Equal(t, "leftover", drainErr.Output)
+	require.Equal(t, `unconsumed output at close: "leftover"`, err.Error())
+}
+
+func TestWithStrictDrainConsumed(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewTestConsole(t, WithStrictDrain())
+	require.NoError(t, err)
+
+	_, err = c.Tty().WriteString("prompt> ")
+	require.NoError(t, err)
+	_, err = c.ExpectString("prompt> ")
+	require.NoError(t, err)
+
+	require.NoError(t, c.Close())
+}
@@ -0,0 +1,99 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package expect
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// startControlled starts sh with script on c's tty, as its controlling
+// terminal so that it receives the tty's signals.
+func startControlled(t *testing.T, c *Console, script string) *exec.Cmd {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found in PATH")
+	}
+
+	cmd := c.Command("sh", "-c", script)
+	require.NoError(t, cmd.Start())
+	return cmd
+}
+
+func TestShutdown(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewTestConsole(t)
+	require.NoError(t, err)
+
+	cmd := startControlled(t, c, "trap 'echo bye; exit 0' INT; echo ready; while :; do sleep 0.05; done")
+	_, err = c.ExpectString("ready")
+	require.NoError(t, err)
+
+	require.NoError(t, c.Shutdown(5*time.Second))
+	require.True(t, c.Closed())
+	require.NoError(t, cmd.Wait())
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewTestConsole(t)
+	require.NoError(t, err)
+
+	cmd := startControlled(t, c, "trap '' INT; echo ready; sleep 5")
+	defer cmd.Process.Kill()
+	_, err = c.ExpectString("ready")
+	require.NoError(t, err)
+
+	err = c.Shutdown(100 * time.Millisecond)
+	require.Error(t, err)
+	require.True(t, os.IsTimeout(errors.Unwrap(err)), "unexpected error: %v", err)
+	require.True(t, c.Closed())
+}
+
+func TestWithExtraFD(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found in PATH")
+	}
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer w.Close()
+
+	c, err := newTestConsole(t, WithExtraFD(r))
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	// The program's output on fd 3 is matched along with its tty output.
+	cmd := c.Command("sh", "-c", `echo starting; echo '{"status":"ok"}' >&3`)
+	cmd.ExtraFiles = []*os.File{w}
+	require.NoError(t, cmd.Start())
+	require.NoError(t, w.Close())
+
+	out, err := c.ExpectString(`{"status":"ok"}`)
+	require.NoError(t, err)
+	require.Equal(t, `starting`+"\r\n"+`{"status":"ok"}`, out)
+	require.NoError(t, cmd.Wait())
+}
@@ -15,5 +15,6 @@
 // Package expect provides an expect-like interface to automate control of
 // applications. It is unlike expect in that it does not spawn or manage
 // process lifecycle. This package only focuses on expecting output and sending
-// input through it's psuedoterminal.
+// input through it's psuedoterminal. Spawn is provided as a thin, optional
+// helper for the common case of starting a command on a Console's tty.
 package expect
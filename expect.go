@@ -17,12 +17,49 @@ package expect
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 	"unicode/utf8"
 )
 
+var (
+	// ErrNoScreen is returned by ExpectScreen when Console was not created
+	// with WithScreen.
+	ErrNoScreen = errors.New("console has no screen, see WithScreen")
+
+	// ErrMarkerNotFound is returned by ExpectBlock when another condition was
+	// met before a marker of the block was read.
+	ErrMarkerNotFound = errors.New("block marker not found")
+
+	// ErrNestedBlock is returned by ExpectBlock when the start marker is read
+	// again before the end marker.
+	ErrNestedBlock = errors.New("nested block")
+
+	// ErrTimeout is the error that timeouts match with errors.Is, such as
+	// the *TimeoutError returned by Expect. os.IsTimeout reports true for it.
+	ErrTimeout error = timeoutError{}
+)
+
+const (
+	// maxEAGAINRetries bounds how many times a read returning EAGAIN is retried
+	// before the error is surfaced.
+	maxEAGAINRetries = 10
+
+	// maxEAGAINBackoff caps the delay between retries of a read returning
+	// EAGAIN.
+	maxEAGAINBackoff = 100 * time.Millisecond
+)
+
 // Expectf reads from the Console's tty until the provided formatted string
 // is read or an error occurs, and returns the buffer read by Console.
 func (c *Console) Expectf(format string, args ...interface{}) (string, error) {
@@ -31,87 +68,959 @@ func (c *Console) Expectf(format string, args ...interface{}) (string, error) {
 
 // ExpectString reads from Console's tty until the provided string is read or
 // an error occurs, and returns the buffer read by Console.
+//
+// Unless the Console has read mutators, auto-responses, a screen, a buffer
+// warning threshold or a startup banner yet to be read, ExpectString takes a
+// faster path than Expect(String(s)) with the same results.
 func (c *Console) ExpectString(s string) (string, error) {
+	if c.literalEligible(s) {
+		return c.expectLiteral(s)
+	}
 	return c.Expect(String(s))
 }
 
+// ExpectAnyString reads from Console's tty until any of the candidates is read
+// or an error occurs, and returns the candidate that was read along with the
+// buffer read by Console. The candidates are found with Earliest, so the one
+// that completes first in the stream wins.
+func (c *Console) ExpectAnyString(candidates ...string) (matched string, buffer string, err error) {
+	buf, matcher, err := c.expect(context.Background(), Earliest(candidates...))
+	if err != nil {
+		return "", buf, err
+	}
+	matched, _ = matcher.Criteria().(string)
+	return matched, buf, nil
+}
+
+// ExpectLine reads from Console's tty until the end of the next line and
+// returns it without its "\n" or "\r\n" ending. Conditions and options from
+// opts, such as timeouts, also apply; if another condition is met, the content
+// read is returned as is.
+func (c *Console) ExpectLine(opts ...ExpectOpt) (string, error) {
+	out, err := c.Expect(append([]ExpectOpt{String("\n")}, opts...)...)
+	if err != nil || !strings.HasSuffix(out, "\n") {
+		return out, err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(out, "\n"), "\r"), nil
+}
+
+// ExpectJSON reads the next line from Console's tty, like ExpectLine, and
+// decodes it as JSON into v, e.g. for a program that prints one JSON object per
+// line. If the line isn't valid JSON, an error wrapping the one from
+// json.Unmarshal is returned.
+func (c *Console) ExpectJSON(v interface{}, opts ...ExpectOpt) error {
+	line, err := c.ExpectLine(opts...)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal([]byte(line), v)
+	if err != nil {
+		return fmt.Errorf("decoding JSON line %q: %w", line, err)
+	}
+	return nil
+}
+
+// ExpectToken reads from Console's tty until the split function yields a token
+// for which match returns true, and returns that token, e.g. to read the
+// records of a NUL-delimited protocol. Tokens are split as with bufio.Scanner,
+// so a token is only complete once the content after it is read, or at EOF.
+// An error from split is returned as is. Conditions and options from opts,
+// such as timeouts, also apply.
+func (c *Console) ExpectToken(split bufio.SplitFunc, match func(token []byte) bool, opts ...ExpectOpt) ([]byte, error) {
+	tm := &tokenMatcher{split: split, match: match}
+	out, err := c.Expect(append([]ExpectOpt{appendMatcher(tm)}, opts...)...)
+	if tm.err != nil {
+		return nil, tm.err
+	}
+	if err != nil {
+		// The last token is only complete at EOF.
+		if !isEOF(err) || !tm.scan([]byte(out), true) {
+			return nil, err
+		}
+		if tm.err != nil {
+			return nil, tm.err
+		}
+	}
+	return tm.token, nil
+}
+
 // ExpectEOF reads from Console's tty until EOF or an error occurs, and returns
 // the buffer read by Console.  We also treat the PTSClosed error as an EOF.
 func (c *Console) ExpectEOF() (string, error) {
 	return c.Expect(EOF, PTSClosed)
 }
 
+// ExpectEOFContext reads from Console's tty until EOF, like ExpectEOF, and
+// returns the number of bytes read. Once ctx is done, it returns ctx.Err()
+// with the number of bytes read so far, so that draining a program that never
+// closes its tty doesn't block forever. The content read is written to
+// Console's stdouts as usual. Conditions and options from opts, such as
+// timeouts, also apply. No goroutine is left reading once it returns.
+func (c *Console) ExpectEOFContext(ctx context.Context, opts ...ExpectOpt) (int64, error) {
+	pm := &progressMatcher{cb: func(n int64) {}}
+	_, err := c.ExpectContext(ctx, append([]ExpectOpt{EOF, PTSClosed, appendMatcher(pm)}, opts...)...)
+	return pm.n, err
+}
+
+// ExpectFrame reads from Console's tty until content has been read and then
+// nothing more is for idle, and returns the content read, e.g. to read one at
+// a time the frames of a protocol that pauses between them. The next frame is
+// left to the next Expect. Conditions and options from opts, such as timeouts,
+// also apply: if output never pauses, the timeout error is returned with the
+// content read so far, so a timeout should be set to bound a frame.
+func (c *Console) ExpectFrame(idle time.Duration, opts ...ExpectOpt) (string, error) {
+	return c.Expect(append([]ExpectOpt{appendMatcher(&idleMatcher{idle: idle})}, opts...)...)
+}
+
+// ExpectEOFProgress is like ExpectEOF, but calls cb with the cumulative number
+// of bytes read from Console's tty as it drains it, about every 32KB and once
+// more when it returns, e.g. to show progress while draining a large output.
+// Conditions and options from opts, such as timeouts, also apply.
+func (c *Console) ExpectEOFProgress(cb func(n int64), opts ...ExpectOpt) (string, error) {
+	pm := &progressMatcher{cb: cb}
+	opts = append([]ExpectOpt{EOF, PTSClosed, appendMatcher(pm)}, opts...)
+	defer pm.report()
+	return c.Expect(opts...)
+}
+
+// SendError is returned by Console methods that send input before expecting,
+// when the send fails. It distinguishes a failure to send from a failure to
+// expect.
+type SendError struct {
+	Msg string
+	Err error
+}
+
+func (e *SendError) Error() string {
+	return fmt.Sprintf("failed to send %q: %s", e.Msg, e.Err)
+}
+
+// Unwrap returns the underlying error from sending.
+func (e *SendError) Unwrap() error {
+	return e.Err
+}
+
+// WaitFor sends string s to Console's tty with a trailing newline, then reads
+// until a condition specified from opts is encountered or an error occurs, and
+// returns the buffer read by Console. If sending fails, a *SendError is
+// returned without expecting.
+func (c *Console) WaitFor(s string, opts ...ExpectOpt) (string, error) {
+	_, err := c.SendLine(s)
+	if err != nil {
+		return "", &SendError{Msg: s, Err: err}
+	}
+	return c.Expect(opts...)
+}
+
+// RunCommand sends cmd to Console's tty with a trailing newline like WaitFor,
+// skips the echo of cmd, then reads until prompt appears again at the end of
+// the content read, and returns the output of cmd in between. The prompt is
+// matched like Prompt as content is read, so output that reads like the prompt
+// at any point, such as "$" in "$HOME" for a prompt of "$", ends the command
+// early; prompts should be distinctive, e.g. "$ ". Tty echo may be split
+// across reads, which is handled the same as any other content. Conditions
+// and options from opts, such as timeouts, apply to reading both the echo and
+// the output; if another condition than the prompt is met, such as EOF, the
+// content read after the echo is returned as is.
+//
+// RunCommand is meant to be called while the shell waits at its prompt, e.g.
+// after expecting the first prompt, so that no earlier prompt is read after
+// the echo.
+func (c *Console) RunCommand(cmd, prompt string, opts ...ExpectOpt) (string, error) {
+	_, err := c.SendLine(cmd)
+	if err != nil {
+		return "", &SendError{Msg: cmd, Err: err}
+	}
+
+	// The echo ends with the newline, which the tty may translate to "\r\n".
+	for _, echo := range []string{cmd, "\n"} {
+		_, err = c.Expect(append([]ExpectOpt{String(echo)}, opts...)...)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	pm := &promptMatcher{symbol: prompt}
+	out, matcher, err := c.expect(context.Background(), append([]ExpectOpt{appendMatcher(pm)}, opts...)...)
+	if err != nil || matcher != pm {
+		return out, err
+	}
+	return out[:pm.locate([]byte(out))[0]], nil
+}
+
+// SendLineWaitEcho sends s to Console's tty with a trailing newline and reads
+// until its echo is read, within timeout, so that a script fails early when
+// its input doesn't get through rather than at a later Expect. The echo ends
+// with the newline, which the tty may translate to "\r\n". It is usually the
+// tty that echoes input, as soon as it is sent; a program that reads with echo
+// disabled, like a password prompt, or that echoes input itself once read,
+// like a shell with line editing, withholds it. An error from sending is
+// returned as a *SendError.
+func (c *Console) SendLineWaitEcho(s string, timeout time.Duration) error {
+	_, err := c.SendLine(s)
+	if err != nil {
+		return &SendError{Msg: s, Err: err}
+	}
+
+	deadline := time.Now().Add(timeout)
+	for _, echo := range []string{s, "\n"} {
+		_, err = c.Expect(String(echo), WithTimeout(time.Until(deadline)))
+		if err != nil {
+			return fmt.Errorf("waiting for echo of %q: %w", s, err)
+		}
+	}
+	return nil
+}
+
+// SendFile sends the lines of the file at path to Console's tty one at a time,
+// as if typed, for programs such as REPLs that can't handle a whole script
+// pasted at once. Lines are sent at least lineDelay apart. If prompt isn't
+// empty, each line is also only sent once prompt is read, so that the prompt
+// the program shows after a line is the signal to send the next one; the
+// prompt after the last line is left to be read by the next Expect, and the
+// content read while waiting is discarded. Lines are sent without their "\n"
+// or "\r\n" ending, followed by "\n". An error from sending is returned as a
+// *SendError.
+func (c *Console) SendFile(path string, lineDelay time.Duration, prompt string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	lines := strings.SplitAfter(string(content), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	for i, line := range lines {
+		if i > 0 && lineDelay > 0 {
+			time.Sleep(lineDelay)
+		}
+		if prompt != "" {
+			_, err = c.ExpectString(prompt)
+			if err != nil {
+				return fmt.Errorf("waiting for prompt before line %d of %s: %w", i+1, path, err)
+			}
+		}
+
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		_, err = c.SendLine(line)
+		if err != nil {
+			return &SendError{Msg: line, Err: err}
+		}
+	}
+	return nil
+}
+
+// Resync reads and discards the output of Console's tty until marker is read,
+// within timeout, so that the next Expect starts right after it, at a known
+// position, e.g. after garbled output. The marker should be unique, such as a
+// token the program is made to echo once, since Resync stops at its first
+// occurrence.
+func (c *Console) Resync(marker string, timeout time.Duration) error {
+	_, err := c.Expect(String(marker), WithTimeout(timeout))
+	if err != nil {
+		return fmt.Errorf("resyncing on %q: %w", marker, err)
+	}
+	return nil
+}
+
+// ExpectThenSend reads from Console's tty until the condition of match is met,
+// then sends response before returning the content read, e.g. to answer a
+// prompt. The response is sent by the Expect itself, which reads no further
+// than the match, so no output that follows the prompt is read before the
+// response is sent; it is left to the next Expect. Conditions and options from
+// opts, such as timeouts, also apply, but meeting another condition doesn't
+// send the response. An error from sending is returned as a *SendError.
+func (c *Console) ExpectThenSend(match ExpectOpt, response string, opts ...ExpectOpt) (string, error) {
+	send := match.Then(func(buf *bytes.Buffer) error {
+		_, err := c.Send(response)
+		if err != nil {
+			return &SendError{Msg: response, Err: err}
+		}
+		return nil
+	})
+	return c.Expect(append([]ExpectOpt{send}, opts...)...)
+}
+
+// SilenceError is returned by ExpectSilence when content is read from
+// Console's tty within the duration it was expected to stay quiet.
+type SilenceError struct {
+	Duration time.Duration
+	Output   string
+}
+
+func (e *SilenceError) Error() string {
+	return fmt.Sprintf("expected no output for %s but got %q", e.Duration, e.Output)
+}
+
+// ExpectSilence reads from Console's tty for duration d and returns nil if
+// nothing was read, or a *SilenceError with the content read otherwise. The
+// whole duration is waited for either way, so that the error holds all the
+// unexpected output.
+func (c *Console) ExpectSilence(d time.Duration) error {
+	_, err := c.Expect(WithTimeout(d), expectSilence)
+	return err
+}
+
+// ReadN reads exactly n bytes from Console's tty, without decoding them as
+// text, and returns them. Bytes are read from the same buffer as Expect, so
+// they are never read by both. If the timeout elapses or reading fails first,
+// the bytes read so far are returned with the error. A zero timeout waits
+// indefinitely. A negative n is an error.
+func (c *Console) ReadN(n int, timeout time.Duration) ([]byte, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("invalid number of bytes %d", n)
+	}
+	if err := c.ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	err := c.setReadDeadline(deadline)
+	if err != nil {
+		return nil, err
+	}
+
+	// The output is written before returning even if reading failed.
+	defer c.stdout.Flush()
+
+	writer := c.outputWriter()
+	p := make([]byte, n)
+	read := 0
+	for read < n {
+		var m int
+		m, err = c.runeReader.Read(p[read:])
+		c.stats.received(m)
+		if m > 0 {
+			c.Logf("read: %q", p[read:read+m])
+			_, werr := writer.Write(p[read : read+m])
+			if werr != nil {
+				return p[:read+m], werr
+			}
+		}
+		read += m
+
+		switch {
+		case err == nil:
+		case errors.Is(err, syscall.EINTR):
+			c.Logf("retrying interrupted read: %s", err)
+		case c.ctx.Err() != nil:
+			return p[:read], c.ctx.Err()
+		case os.IsTimeout(err):
+			return p[:read], c.timeoutError(bytes.NewBuffer(p[:read]), read)
+		default:
+			return p[:read], err
+		}
+	}
+	return p, c.stdout.Flush()
+}
+
+// ExpectLengthPrefixed reads a frame of a length-prefixed protocol from
+// Console's tty: a length field of lenBytes bytes, in big or little endian
+// order, then that many payload bytes, which are returned. Both are read with
+// ReadN, and only timeouts and WithMaxFrameSize from opts apply, the timeouts
+// to reading the whole frame. A length larger than the maximum frame size is
+// an error wrapping ErrFrameTooLarge. If reading the payload fails, the
+// payload bytes read so far are returned with the error.
+func (c *Console) ExpectLengthPrefixed(lenBytes int, bigEndian bool, opts ...ExpectOpt) ([]byte, error) {
+	if lenBytes <= 0 || lenBytes > 8 {
+		return nil, fmt.Errorf("invalid length field size %d", lenBytes)
+	}
+
+	var options ExpectOpts
+	for _, opt := range opts {
+		if err := opt(&options); err != nil {
+			return nil, err
+		}
+	}
+	readTimeout := c.opts.ReadTimeout
+	if options.ReadTimeout != nil {
+		readTimeout = options.ReadTimeout
+	}
+	var deadline time.Time
+	if readTimeout != nil {
+		deadline = time.Now().Add(*readTimeout)
+	}
+	remaining := func() time.Duration {
+		if deadline.IsZero() {
+			return 0
+		}
+		// ReadN waits indefinitely on a zero timeout, so never pass one.
+		if d := time.Until(deadline); d > 0 {
+			return d
+		}
+		return time.Nanosecond
+	}
+
+	field, err := c.ReadN(lenBytes, remaining())
+	if err != nil {
+		return nil, fmt.Errorf("reading frame length: %w", err)
+	}
+	var n uint64
+	for i := range field {
+		b := field[i]
+		if !bigEndian {
+			b = field[len(field)-1-i]
+		}
+		n = n<<8 | uint64(b)
+	}
+	maxFrameSize := options.maxFrameSize
+	if maxFrameSize == 0 {
+		maxFrameSize = defaultMaxFrameSize
+	}
+	if n > uint64(maxFrameSize) {
+		return nil, fmt.Errorf("%w: length %d exceeds %d bytes", ErrFrameTooLarge, n, maxFrameSize)
+	}
+
+	payload, err := c.ReadN(int(n), remaining())
+	if err != nil {
+		return payload, fmt.Errorf("reading frame payload of %d bytes: %w", n, err)
+	}
+	return payload, nil
+}
+
+// ExpectBlock reads from Console's tty until the start marker is read, then
+// until the end marker is read, and returns the content in between, excluding
+// the markers. Conditions and options from opts, such as timeouts, apply to
+// reading each marker.
+//
+// If another condition is met or an error occurs before a marker is read, an
+// error mentioning the marker is returned, which wraps ErrMarkerNotFound or
+// the error. If the start marker is read again before the end marker,
+// ErrNestedBlock is returned with the content read so far.
+func (c *Console) ExpectBlock(start, end string, opts ...ExpectOpt) (string, error) {
+	opts = opts[:len(opts):len(opts)]
+
+	startMatcher := &stringMatcher{str: start}
+	_, matcher, err := c.expect(context.Background(), append(opts, appendMatcher(startMatcher))...)
+	if err == nil && matcher != startMatcher {
+		err = ErrMarkerNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("expecting block start %q: %w", start, err)
+	}
+
+	endMatcher := &stringMatcher{str: end}
+	nestedMatcher := &stringMatcher{str: start}
+	endOpts := append(opts, appendMatcher(endMatcher))
+	if start != end {
+		endOpts = append(endOpts, appendMatcher(nestedMatcher))
+	}
+
+	buf, matcher, err := c.expect(context.Background(), endOpts...)
+	switch {
+	case err != nil:
+	case matcher == nestedMatcher:
+		err = fmt.Errorf("%w started again", ErrNestedBlock)
+	case matcher != endMatcher:
+		err = ErrMarkerNotFound
+	default:
+		return buf[:strings.Index(buf, end)], nil
+	}
+	return buf, fmt.Errorf("expecting block end %q: %w", end, err)
+}
+
+// ExpectScreen reads from Console's tty until a condition specified from opts
+// is encountered on the screen maintained by WithScreen, or an error occurs,
+// and returns the rendered screen. Conditions are matched against Screen
+// rather than the bytes read, so cursor movements and erasures are taken into
+// account.
+func (c *Console) ExpectScreen(opts ...ExpectOpt) (string, error) {
+	if c.screen == nil {
+		return "", ErrNoScreen
+	}
+	_, err := c.Expect(append(opts, matchScreen)...)
+	return c.screen.String(), err
+}
+
+// outputWriter returns the writer that content read from Console's tty is
+// duplicated to: its stdouts and its screen, if any.
+func (c *Console) outputWriter() io.Writer {
+	if c.screen == nil {
+		return c.stdout
+	}
+	return io.MultiWriter(c.stdout, c.screen)
+}
+
+// matchTarget returns the buffer Expect matches conditions against: the
+// content read so far, or the rendered screen for ExpectScreen.
+func (c *Console) matchTarget(options ExpectOpts, buf *bytes.Buffer) *bytes.Buffer {
+	if !options.screen {
+		return buf
+	}
+	return bytes.NewBufferString(c.screen.String())
+}
+
+// match returns the first condition of options met by the match target or,
+// for ExpectScreen, by the position of the screen's cursor.
+func (c *Console) match(options ExpectOpts, buf *bytes.Buffer) Matcher {
+	matcher := options.Match(c.matchTarget(options, buf))
+	if matcher == nil && options.screen {
+		matcher = options.Match(c.screen.cursor())
+	}
+	return matcher
+}
+
 // Expect reads from Console's tty until a condition specified from opts is
 // encountered or an error occurs, and returns the buffer read by console.
 // No extra bytes are read once a condition is met, so if a program isn't
 // expecting input yet, it will be blocked. Sends are queued up in tty's
 // internal buffer so that the next Expect will read the remaining bytes (i.e.
 // rest of prompt) as well as its conditions.
+//
+// A timeout set by WithTimeout or WithDefaultTimeout is a wall-clock budget for
+// the entire call, regardless of how many bytes arrive in the meantime.
+//
+// If the Console was created with NewConsoleContext and its context is done,
+// Expect returns the context's error. If the Console is closed, Expect returns
+// ErrClosed immediately.
+//
+// Whatever the error, Expect returns the content read so far along with it,
+// e.g. for diagnostics, including the rune whose writing to the stdouts
+// failed.
 func (c *Console) Expect(opts ...ExpectOpt) (string, error) {
+	return c.ExpectContext(context.Background(), opts...)
+}
+
+// ExpectContext is like Expect, but also returns ctx.Err() once ctx is done.
+// Any timeout from opts or the Console's default timeout applies in addition
+// to ctx.
+func (c *Console) ExpectContext(ctx context.Context, opts ...ExpectOpt) (string, error) {
+	buf, _, err := c.expect(ctx, opts...)
+	return buf, err
+}
+
+// ExpectMatch is like Expect, but returns a Match describing the outcome: the
+// content read, the condition that was met and where, and what kind of
+// condition it was. Whatever the error, the Match holds the content read so
+// far in Buffer, and the rest of its fields are only set if err is nil.
+func (c *Console) ExpectMatch(opts ...ExpectOpt) (*Match, error) {
+	return c.ExpectMatchContext(context.Background(), opts...)
+}
+
+// ExpectMatchContext is like ExpectMatch, but also returns ctx.Err() once ctx
+// is done, like ExpectContext.
+func (c *Console) ExpectMatchContext(ctx context.Context, opts ...ExpectOpt) (*Match, error) {
+	buf, matcher, err := c.expect(ctx, opts...)
+	if err != nil {
+		return newMatch(nil, []byte(buf)), err
+	}
+	return newMatch(matcher, []byte(buf)), nil
+}
+
+// ExpectScreenMatch is like ExpectScreen, but returns a Match describing the
+// outcome, whose Buffer is the rendered screen that conditions were matched
+// against, and whose offsets are in it.
+func (c *Console) ExpectScreenMatch(opts ...ExpectOpt) (*Match, error) {
+	if c.screen == nil {
+		return newMatch(nil, nil), ErrNoScreen
+	}
+	_, matcher, err := c.expect(context.Background(), append(opts, matchScreen)...)
+	if err != nil {
+		matcher = nil
+	}
+	return newMatch(matcher, []byte(c.screen.String())), err
+}
+
+// ExpectReader reads from r until a condition specified from opts is
+// encountered or an error occurs, and returns the content read, like Expect
+// does for Console's tty. It runs the same conditions without a live process,
+// e.g. to check them against a recorded session. At the end of r, EOF is
+// returned unless it is one of the conditions.
+func ExpectReader(r io.Reader, opts ...ExpectOpt) (string, error) {
+	// Reading through a PassthroughPipe lets timeouts interrupt reads that
+	// block.
+	passthroughPipe, err := NewPassthroughPipe(r)
+	if err != nil {
+		return "", err
+	}
+	defer passthroughPipe.Close()
+
+	options := ConsoleOpts{Logger: log.New(ioutil.Discard, "", 0)}
+	c := &Console{
+		ctx:             context.Background(),
+		opts:            options,
+		stdout:          newStdoutWriter(options),
+		stats:           new(stats),
+		passthroughPipe: passthroughPipe,
+		runeReader:      bufio.NewReaderSize(passthroughPipe, utf8.UTFMax),
+	}
+	return c.Expect(opts...)
+}
+
+// ExpectReason is like Expect, but also returns which kind of condition was
+// met, so that callers can tell a matched pattern apart from EOF or a process
+// exit watched by ProcessExit. The reason is only meaningful if err is nil.
+func (c *Console) ExpectReason(opts ...ExpectOpt) (string, MatchReason, error) {
+	buf, matcher, err := c.expect(context.Background(), opts...)
+	if err != nil {
+		return buf, MatchedPattern, err
+	}
+	return buf, matchReason(matcher), nil
+}
+
+// MapError is returned by ExpectValue when the function of a Map condition
+// fails to transform the text that met it.
+type MapError struct {
+	Match string
+	Err   error
+}
+
+func (e *MapError) Error() string {
+	return fmt.Sprintf("failed to map %q: %s", e.Match, e.Err)
+}
+
+// Unwrap returns the underlying error from the function.
+func (e *MapError) Unwrap() error {
+	return e.Err
+}
+
+// ExpectValue is like Expect, but returns the value that the function of the
+// Map condition that was met returned for the text that met it. If the
+// condition met wasn't added by Map, a nil value is returned. If the function
+// fails, a *MapError wrapping its error is returned.
+func (c *Console) ExpectValue(opts ...ExpectOpt) (interface{}, error) {
+	buf, matcher, err := c.expect(context.Background(), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	mm := mapperOf(matcher)
+	if mm == nil {
+		return nil, nil
+	}
+
+	match := buf
+	if loc := locate(mm, []byte(buf)); loc != nil {
+		match = buf[loc[0]:loc[1]]
+	}
+	v, err := mm.fn(match)
+	if err != nil {
+		return nil, &MapError{Match: match, Err: err}
+	}
+	return v, nil
+}
+
+// ExpectTitle reads from Console's tty until a program sets the terminal's
+// title, see OSCTitle, or a condition from opts is met, and returns the title.
+// If another condition was met, an empty title is returned.
+func (c *Console) ExpectTitle(opts ...ExpectOpt) (string, error) {
+	title := Map(OSCTitle(), func(match string) (interface{}, error) {
+		return oscTitle.FindStringSubmatch(match)[1], nil
+	})
+	v, err := c.ExpectValue(append([]ExpectOpt{title}, opts...)...)
+	s, _ := v.(string)
+	return s, err
+}
+
+// ExpectOr reads from Console's tty until the condition of patternOpt is met,
+// or until EOF if the program exits first, and returns which of them ended the
+// Expect: MatchedPattern or MatchedEOF. Unlike Expect, reaching EOF is not an
+// error, which suits waiting for a prompt at the end of a session, when the
+// program may exit instead. Options from opts, such as timeouts, also apply.
+func (c *Console) ExpectOr(patternOpt ExpectOpt, opts ...ExpectOpt) (string, MatchReason, error) {
+	return c.ExpectReason(append([]ExpectOpt{patternOpt, EOF, PTSClosed}, opts...)...)
+}
+
+// expect implements ExpectContext and returns the matcher whose condition was
+// met.
+func (c *Console) expect(ctx context.Context, opts ...ExpectOpt) (string, Matcher, error) {
+	if err := c.ctx.Err(); err != nil {
+		return "", nil, err
+	}
+	if c.Closed() {
+		return "", nil, ErrClosed
+	}
+
 	var options ExpectOpts
 	for _, opt := range opts {
 		if err := opt(&options); err != nil {
-			return "", err
+			return "", nil, err
 		}
 	}
 
+	if banner := c.banner.take(); banner != nil {
+		bannerOpts := []ExpectOpt{banner, readBanner}
+		if options.ReadTimeout != nil {
+			bannerOpts = append(bannerOpts, WithTimeout(*options.ReadTimeout))
+		}
+		out, _, err := c.expect(ctx, bannerOpts...)
+		if err != nil {
+			c.stats.expected(err)
+			return out, nil, err
+		}
+	}
+
+	responder, err := newAutoResponder(c.opts.AutoRules)
+	if err != nil {
+		return "", nil, err
+	}
+
 	buf := new(bytes.Buffer)
-	writer := io.MultiWriter(append(c.opts.Stdouts, buf)...)
-	runeWriter := bufio.NewWriterSize(writer, utf8.UTFMax)
+	runeWriter := bufio.NewWriterSize(c.outputWriter(), utf8.UTFMax)
 
 	readTimeout := c.opts.ReadTimeout
 	if options.ReadTimeout != nil {
 		readTimeout = options.ReadTimeout
 	}
 
+	parent := ctx
+	cancel := func() {}
+	if readTimeout != nil {
+		ctx, cancel = context.WithTimeout(ctx, *readTimeout)
+	}
+	defer func() {
+		cancel()
+	}()
+	// awaitingFirstByte is set while the timeout only caps the wait for the
+	// first rune, see WithStartTimeoutOnFirstByte.
+	awaitingFirstByte := options.startOnFirstByte && readTimeout != nil
+
 	var matcher Matcher
-	var err error
+	stable := &stability{window: options.stableFor}
+	// warned is set once the buffer warning of WithBufferWarnThreshold is
+	// logged.
+	warned := false
+	// received is the number of bytes read from the tty, which may differ from
+	// the length of buf once it is mutated.
+	received := 0
 
+	c.inFlight.begin(options.Matchers)
 	defer func() {
+		c.inFlight.end()
+		// The output is written before returning even if Expect failed, in
+		// which case that error is returned rather than the write's.
+		if ferr := c.stdout.Flush(); ferr != nil && err != nil {
+			c.Logf("failed to write to stdout: %s", ferr)
+		}
+		if options.banner {
+			return
+		}
+		c.stats.expected(err)
+		if options.silentObservers {
+			return
+		}
 		for _, observer := range c.opts.ExpectObservers {
 			if matcher != nil {
 				observer([]Matcher{matcher}, buf.String(), err)
-				return
+				continue
 			}
 			observer(options.Matchers, buf.String(), err)
 		}
+		if len(c.opts.MatchObservers) > 0 {
+			match := newMatch(matcher, c.matchTarget(options, buf).Bytes())
+			for _, observer := range c.opts.MatchObservers {
+				observer(match, err)
+			}
+		}
 	}()
 
-	for {
-		if readTimeout != nil {
-			err = c.passthroughPipe.SetReadDeadline(time.Now().Add(*readTimeout))
-			if err != nil {
-				return buf.String(), err
+	// timedOut returns the error for an Expect whose ctx is done, which is a
+	// success when silence was expected and nothing was read.
+	timedOut := func() error {
+		if !options.silence || parent.Err() != nil {
+			if err := parent.Err(); err != nil {
+				return err
 			}
+			return c.timeoutError(buf, received)
+		}
+		if buf.Len() > 0 {
+			return &SilenceError{Duration: *readTimeout, Output: buf.String()}
+		}
+		return nil
+	}
+
+	if options.screen {
+		// The screen may already show what is expected from previous output.
+		matcher = stable.confirm(c.match(options, buf), buf.Len(), time.Now())
+	}
+
+	// The deadline is absolute, so it bounds the entire call rather than each
+	// read. A zero deadline clears any deadline left by a previous Expect.
+	deadline, _ := ctx.Deadline()
+	progress := newProgressLog(options.ProgressLog, time.Now())
+	readDeadline := progress.deadline(stable.deadline(options.nextDeadline(deadline, time.Now())))
+	err = c.setReadDeadline(readDeadline)
+	if err != nil {
+		return buf.String(), nil, err
+	}
+
+	var eventC <-chan struct{}
+	if events := options.events(); len(events) > 0 {
+		var stop func()
+		eventC, stop = mergeEvents(events)
+		defer stop()
+	}
+	stopInterrupt := func() {}
+	if ctx.Done() != nil || eventC != nil {
+		stopInterrupt = c.interruptOnDone(ctx, eventC)
+	}
+	defer func() {
+		stopInterrupt()
+	}()
+
+	for matcher == nil {
+		// Runes may already be buffered, so the deadline is checked on each
+		// iteration rather than only when a read blocks.
+		if ctx.Err() != nil {
+			err = timedOut()
+			return buf.String(), nil, err
+		}
+		if options.expired(time.Now()) {
+			err = c.timeoutError(buf, received)
+			return buf.String(), nil, err
 		}
+		progress.log(c, buf, time.Now())
 
 		var r rune
-		r, _, err = c.runeReader.ReadRune()
+		var size int
+		var partial []byte
+		r, size, err = c.readRune()
+		if err == nil {
+			partial, err = c.incompleteRune(r, size)
+		}
 		if err != nil {
+			if ctxErr := c.ctx.Err(); ctxErr != nil {
+				err = ctxErr
+				return buf.String(), nil, err
+			}
+			if os.IsTimeout(err) {
+				if ctx.Err() != nil {
+					err = timedOut()
+					return buf.String(), nil, err
+				}
+
+				// The read was interrupted by an event, a condition expiring or a
+				// progress log, so the conditions are evaluated again before the
+				// deadline is moved to the next one.
+				matcher = stable.confirm(c.match(options, buf), buf.Len(), time.Now())
+				if matcher != nil {
+					err = nil
+					break
+				}
+				readDeadline = progress.deadline(stable.deadline(options.nextDeadline(deadline, time.Now())))
+				err = c.setReadDeadline(readDeadline)
+				if err != nil {
+					return buf.String(), nil, err
+				}
+				continue
+			}
+
 			matcher = options.Match(err)
+			if matcher == nil && eventC != nil && isEOF(err) {
+				// The tty may reach EOF just before the process it belongs to
+				// exits, so wait for the event rather than failing.
+				select {
+				case <-eventC:
+					matcher = options.Match(err)
+				case <-ctx.Done():
+					err = timedOut()
+					return buf.String(), nil, err
+				case <-c.ctx.Done():
+					err = c.ctx.Err()
+					return buf.String(), nil, err
+				}
+			}
 			if matcher != nil {
 				err = nil
 				break
 			}
-			return buf.String(), err
+			return buf.String(), nil, err
+		}
+
+		if awaitingFirstByte {
+			// The timeout starts over from the first rune. The interrupt is
+			// stopped first so that cancelling the previous timeout can't
+			// interrupt the next read.
+			awaitingFirstByte = false
+			stopInterrupt()
+			cancel()
+			var restarted context.CancelFunc
+			ctx, restarted = context.WithTimeout(parent, *readTimeout)
+			cancel = restarted
+			deadline, _ = ctx.Deadline()
+			stopInterrupt = c.interruptOnDone(ctx, eventC)
 		}
 
-		c.Logf("expect read: %q", string(r))
-		_, err = runeWriter.WriteRune(r)
+		// The rune is added to the content read before it is written to the
+		// stdouts, so that it is returned even if writing it fails.
+		if partial != nil {
+			c.stats.received(len(partial))
+			received += len(partial)
+			c.Logf("expect read incomplete rune: %q", partial)
+			buf.Write(partial)
+			c.inFlight.received(r)
+			_, err = runeWriter.Write(partial)
+		} else {
+			c.stats.received(size)
+			received += size
+			c.Logf("expect read: %q", string(r))
+			buf.WriteRune(r)
+			c.inFlight.received(r)
+			_, err = runeWriter.WriteRune(r)
+		}
 		if err != nil {
-			return buf.String(), err
+			return buf.String(), nil, err
 		}
 
 		// Immediately flush rune to the underlying writers.
 		err = runeWriter.Flush()
 		if err != nil {
-			return buf.String(), err
+			return buf.String(), nil, err
+		}
+
+		for _, mutator := range c.opts.ReadMutators {
+			mutator(buf)
+		}
+
+		if responder != nil {
+			err = responder.respond(c, buf)
+			if err != nil {
+				return buf.String(), nil, err
+			}
 		}
 
-		matcher = options.Match(buf)
+		matcher = stable.confirm(c.match(options, buf), buf.Len(), time.Now())
 		if matcher != nil {
 			break
 		}
+
+		raw := RawBytes(partial)
+		if raw == nil {
+			raw = c.rawRune(r, size)
+		}
+		matcher = options.Match(raw)
+		if matcher != nil {
+			break
+		}
+
+		if !warned && c.opts.BufferWarnThreshold > 0 && buf.Len() > c.opts.BufferWarnThreshold {
+			warned = true
+			c.warnBuffer(options, buf)
+		}
+
+		err = options.abort(c.matchTarget(options, buf))
+		if err != nil {
+			return buf.String(), nil, err
+		}
+
+		// Conditions such as ExpectFrame's move their deadline as content is
+		// read.
+		if next := progress.deadline(stable.deadline(options.nextDeadline(deadline, time.Now()))); !next.Equal(readDeadline) {
+			readDeadline = next
+			err = c.setReadDeadline(readDeadline)
+			if err != nil {
+				return buf.String(), nil, err
+			}
+		}
+	}
+
+	err = c.stdout.Flush()
+	if err != nil {
+		return buf.String(), nil, err
 	}
 
 	if matcher != nil {
@@ -119,10 +1028,240 @@ func (c *Console) Expect(opts ...ExpectOpt) (string, error) {
 		if ok {
 			err = cb.Callback(buf)
 			if err != nil {
-				return buf.String(), err
+				return buf.String(), nil, err
+			}
+		}
+	}
+
+	return buf.String(), matcher, err
+}
+
+// progressLogTail is how many bytes at the end of the content read are logged
+// by WithProgressLog.
+const progressLogTail = 256
+
+// progressLog logs the content read by an Expect at an interval, see
+// WithProgressLog.
+type progressLog struct {
+	interval time.Duration
+	start    time.Time
+	next     time.Time
+}
+
+func newProgressLog(interval time.Duration, now time.Time) *progressLog {
+	if interval <= 0 {
+		return nil
+	}
+	return &progressLog{interval: interval, start: now, next: now.Add(interval)}
+}
+
+// deadline returns the earliest of deadline and the time of the next log.
+func (pl *progressLog) deadline(deadline time.Time) time.Time {
+	if pl == nil || (!deadline.IsZero() && deadline.Before(pl.next)) {
+		return deadline
+	}
+	return pl.next
+}
+
+// log logs the tail of buf if the next log is due by now.
+func (pl *progressLog) log(c *Console, buf *bytes.Buffer, now time.Time) {
+	if pl == nil || now.Before(pl.next) {
+		return
+	}
+	pl.next = now.Add(pl.interval)
+
+	tail := buf.Bytes()
+	if len(tail) > progressLogTail {
+		tail = tail[len(tail)-progressLogTail:]
+	}
+	c.Logf("expect still waiting after %s, read %d bytes ending in %q", now.Sub(pl.start).Round(time.Millisecond), buf.Len(), tail)
+}
+
+// warnBuffer logs a warning that buf has grown past the threshold of
+// WithBufferWarnThreshold without options' conditions being met.
+func (c *Console) warnBuffer(options ExpectOpts, buf *bytes.Buffer) {
+	var criteria []string
+	for _, matcher := range options.Matchers {
+		criteria = append(criteria, fmt.Sprintf("%q", matcher.Criteria()))
+	}
+	tail := buf.Bytes()
+	if len(tail) > progressLogTail {
+		tail = tail[len(tail)-progressLogTail:]
+	}
+	c.Logf("warning: expect read %d bytes without finding [%s], ending in %q", buf.Len(), strings.Join(criteria, ", "), tail)
+}
+
+// isEOF reports whether err means Console's tty has no more content, either
+// io.EOF or the error from reading the ptm after the pts is closed.
+func isEOF(err error) bool {
+	return err == io.EOF || errors.Is(err, syscall.EIO)
+}
+
+// timeoutError is returned when the timeout of an Expect elapses.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// TimeoutError is returned by Expect when its timeout or deadline elapses
+// before a condition is met. errors.Is reports it as ErrTimeout, and
+// os.IsTimeout reports true for it.
+type TimeoutError struct {
+	// Buffer is all the content read by the Expect, regardless of how much of
+	// it is included in the message, see WithErrorContextBytes.
+	Buffer string
+	// ReceivedAnyBytes reports whether anything was read from Console's tty
+	// by the Expect. If not, the program likely produced no output at all
+	// rather than output that didn't meet the conditions. It may be true even
+	// if Buffer is empty, e.g. when a ReadMutator removed what was read.
+	ReceivedAnyBytes bool
+
+	contextBytes int
+}
+
+func (e *TimeoutError) Error() string {
+	if e.Buffer == "" {
+		return "i/o timeout"
+	}
+
+	tail := e.Buffer
+	if e.contextBytes > 0 && len(tail) > e.contextBytes {
+		start := len(tail) - e.contextBytes
+		for start < len(tail) && !utf8.RuneStart(tail[start]) {
+			start++
+		}
+		tail = "..." + tail[start:]
+	}
+	return fmt.Sprintf("i/o timeout after reading %q", tail)
+}
+
+func (e *TimeoutError) Timeout() bool   { return true }
+func (e *TimeoutError) Temporary() bool { return true }
+
+// Is reports whether target is ErrTimeout.
+func (e *TimeoutError) Is(target error) bool {
+	return target == ErrTimeout
+}
+
+// timeoutError returns the *TimeoutError for an Expect that read buf, from
+// received bytes of Console's tty.
+func (c *Console) timeoutError(buf *bytes.Buffer, received int) error {
+	return &TimeoutError{
+		Buffer:           buf.String(),
+		ReceivedAnyBytes: received > 0,
+		contextBytes:     c.opts.ErrorContextBytes,
+	}
+}
+
+// setReadDeadline sets the deadline for reads from Console's tty. Consoles
+// that don't read through a PassthroughPipe don't support deadlines.
+func (c *Console) setReadDeadline(t time.Time) error {
+	if c.passthroughPipe == nil {
+		return nil
+	}
+	return c.passthroughPipe.SetReadDeadline(t)
+}
+
+// interruptOnDone unblocks reads from Console's tty once ctx is done or
+// eventC is closed. The returned function must be called before the next read
+// is started, so that the interrupt can't leak into it.
+func (c *Console) interruptOnDone(ctx context.Context, eventC <-chan struct{}) (stop func()) {
+	stopC := make(chan struct{})
+	doneC := make(chan struct{})
+	go func() {
+		defer close(doneC)
+		for {
+			select {
+			case <-ctx.Done():
+				c.interruptRead()
+				return
+			case <-eventC:
+				// Events only occur once, but ctx may still be done later.
+				eventC = nil
+				c.interruptRead()
+			case <-stopC:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(stopC)
+		<-doneC
+	}
+}
+
+// interruptRead unblocks a read from Console's tty.
+func (c *Console) interruptRead() {
+	err := c.setReadDeadline(time.Now())
+	if err != nil {
+		c.Logf("failed to interrupt read: %s", err)
+	}
+}
+
+// mergeEvents returns a channel that is closed once any of events is closed.
+// The returned function releases the goroutines watching events.
+func mergeEvents(events []<-chan struct{}) (<-chan struct{}, func()) {
+	eventC := make(chan struct{})
+	stopC := make(chan struct{})
+	var once sync.Once
+	var wg sync.WaitGroup
+	for _, event := range events {
+		wg.Add(1)
+		go func(event <-chan struct{}) {
+			defer wg.Done()
+			select {
+			case <-event:
+				once.Do(func() { close(eventC) })
+			case <-stopC:
+			}
+		}(event)
+	}
+	return eventC, func() {
+		close(stopC)
+		wg.Wait()
+	}
+}
+
+// rawRune returns the bytes of rune r of width size as read from Console's
+// tty. Invalid UTF-8 is decoded to utf8.RuneError, so the byte behind it is
+// read again.
+func (c *Console) rawRune(r rune, size int) RawBytes {
+	if r == utf8.RuneError && size == 1 {
+		err := c.runeReader.UnreadRune()
+		if err == nil {
+			b, err := c.runeReader.ReadByte()
+			if err == nil {
+				return RawBytes{b}
 			}
 		}
 	}
 
-	return buf.String(), err
+	raw := make(RawBytes, utf8.UTFMax)
+	return raw[:utf8.EncodeRune(raw, r)]
+}
+
+// readRune reads a single rune from Console's tty. Reads interrupted by a
+// signal (EINTR) are retried transparently, and reads that would block
+// (EAGAIN) are retried with a bounded backoff, so that only genuine errors or
+// EOF are returned.
+func (c *Console) readRune() (r rune, size int, err error) {
+	backoff := time.Millisecond
+	for retries := 0; ; {
+		r, size, err = c.runeReader.ReadRune()
+		switch {
+		case errors.Is(err, syscall.EINTR):
+			c.Logf("retrying interrupted read: %s", err)
+		case errors.Is(err, syscall.EAGAIN) && retries < maxEAGAINRetries:
+			c.Logf("retrying read in %s: %s", backoff, err)
+			time.Sleep(backoff)
+			retries++
+			backoff *= 2
+			if backoff > maxEAGAINBackoff {
+				backoff = maxEAGAINBackoff
+			}
+		default:
+			return r, size, err
+		}
+	}
 }
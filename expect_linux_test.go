@@ -0,0 +1,54 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpectSignalDuringRead(t *testing.T) {
+	// The timeout fails the test rather than hanging it if the read is never
+	// resumed.
+	c, err := NewTestConsole(t, WithDefaultTimeout(time.Second))
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// SIGWINCH is ignored by default, so delivering it only interrupts the
+		// blocked read.
+		for i := 0; i < 10; i++ {
+			err := syscall.Kill(os.Getpid(), syscall.SIGWINCH)
+			if err != nil {
+				t.Errorf("Expected no error but got '%s'", err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		c.Tty().WriteString("ready")
+	}()
+
+	out, err := c.ExpectString("ready")
+	wg.Wait()
+	require.NoError(t, err)
+	require.Equal(t, "ready", out)
+}
@@ -15,7 +15,10 @@
 package expect
 
 import (
+	"bufio"
 	"bytes"
+	"errors"
+	"fmt"
 	"io"
 	"os"
 	"regexp"
@@ -24,6 +27,32 @@ import (
 	"time"
 )
 
+// ErrPrefixMismatch is returned by Expect when content read from Console's tty
+// doesn't start with the string of a Prefix condition.
+var ErrPrefixMismatch = errors.New("output does not start with prefix")
+
+// ErrMaxLines is returned by Expect when the number of lines set by
+// WithMaxLines is read before any condition is met.
+var ErrMaxLines = errors.New("maximum number of lines read")
+
+// AbortError is returned by Expect when a condition added by Forbid is met,
+// aborting the Expect.
+type AbortError struct {
+	// Matcher is the forbidden condition that was met.
+	Matcher Matcher
+
+	// Buffer is the content read by Expect up to the point it was aborted.
+	Buffer string
+
+	// Offset is the byte offset in Buffer of the content that met Matcher, or
+	// -1 if the condition doesn't locate its matches.
+	Offset int
+}
+
+func (e *AbortError) Error() string {
+	return fmt.Sprintf("forbidden %v found at offset %d", e.Matcher.Criteria(), e.Offset)
+}
+
 // ExpectOpt allows settings Expect options.
 type ExpectOpt func(*ExpectOpts) error
 
@@ -35,6 +64,170 @@ func WithTimeout(timeout time.Duration) ExpectOpt {
 	}
 }
 
+// WithStartTimeoutOnFirstByte starts the read timeout of an Expect statement,
+// from WithTimeout or the Console's default, when the first rune is read
+// rather than when Expect is called, so that a program's startup latency
+// doesn't eat into the time given to produce the expected output. Waiting for
+// the first rune is capped by the timeout too, so if nothing is read within
+// it, Expect times out as usual, and in total it waits at most twice the
+// timeout. Without a timeout, it has no effect.
+func WithStartTimeoutOnFirstByte() ExpectOpt {
+	return func(opts *ExpectOpts) error {
+		opts.startOnFirstByte = true
+		return nil
+	}
+}
+
+// WithStableFor makes Expect only succeed once a condition met by the content
+// read stays met for d without anything more being read, so that a pattern
+// such as a trailing prompt isn't matched against content that only looked
+// complete because it arrived in chunks. Content read in the meantime restarts
+// the wait if the condition is still met, and resumes reading otherwise.
+// Conditions on raw bytes or errors, such as Bytes or EOF, are met
+// immediately, and the timeout still bounds the whole call.
+func WithStableFor(d time.Duration) ExpectOpt {
+	return func(opts *ExpectOpts) error {
+		opts.stableFor = d
+		return nil
+	}
+}
+
+// ErrFrameTooLarge is returned by ExpectLengthPrefixed when the length field of
+// a frame exceeds the maximum frame size, see WithMaxFrameSize.
+var ErrFrameTooLarge = errors.New("frame too large")
+
+// defaultMaxFrameSize is the largest payload ExpectLengthPrefixed accepts
+// unless WithMaxFrameSize is set.
+const defaultMaxFrameSize = 16 << 20
+
+// WithMaxFrameSize sets the largest payload in bytes that ExpectLengthPrefixed
+// accepts, which defaults to 16MB. A frame whose length field is larger fails
+// with an error wrapping ErrFrameTooLarge before its payload is read, so that
+// a corrupt length doesn't allocate a huge buffer.
+func WithMaxFrameSize(n int) ExpectOpt {
+	return func(opts *ExpectOpts) error {
+		if n <= 0 {
+			return fmt.Errorf("invalid maximum frame size %d", n)
+		}
+		opts.maxFrameSize = n
+		return nil
+	}
+}
+
+// WithMaxLines makes Expect fail with an error wrapping ErrMaxLines once n
+// newline-terminated lines are read from Console's tty without any condition
+// being met, e.g. to find "ready" within the next 500 lines of a log. Lines are
+// counted on the bytes read, before any ReadMutator, and the timeout still
+// applies.
+func WithMaxLines(n int) ExpectOpt {
+	return func(opts *ExpectOpts) error {
+		if n <= 0 {
+			return fmt.Errorf("invalid maximum number of lines %d", n)
+		}
+		opts.Matchers = append(opts.Matchers, &lineBudgetMatcher{max: n})
+		return nil
+	}
+}
+
+// lineBudgetMatcher fulfills the Matcher interface to abort an Expect once it
+// has read a number of lines, without ever matching, see WithMaxLines.
+type lineBudgetMatcher struct {
+	max   int
+	lines int
+}
+
+func (lm *lineBudgetMatcher) Match(v interface{}) bool {
+	raw, ok := v.(RawBytes)
+	if ok {
+		lm.lines += bytes.Count(raw, []byte("\n"))
+	}
+	return false
+}
+
+func (lm *lineBudgetMatcher) abort(buf *bytes.Buffer) error {
+	if lm.lines < lm.max {
+		return nil
+	}
+	return fmt.Errorf("%w: %d lines read without a match", ErrMaxLines, lm.lines)
+}
+
+func (lm *lineBudgetMatcher) Criteria() interface{} {
+	return fmt.Sprintf("at most %d lines", lm.max)
+}
+
+// stability holds the condition met by the content read while Expect waits
+// for it to be stable, see WithStableFor.
+type stability struct {
+	window time.Duration
+	// pending is the condition met when read bytes had been read, since.
+	pending Matcher
+	read    int
+	since   time.Time
+}
+
+// confirm returns matcher, met with read bytes read by now, once it has been
+// met for the window without more bytes being read, otherwise nil.
+func (s *stability) confirm(matcher Matcher, read int, now time.Time) Matcher {
+	if s.window <= 0 {
+		return matcher
+	}
+	if matcher == nil {
+		s.pending = nil
+		return nil
+	}
+	if s.pending == nil || read != s.read {
+		s.pending, s.read, s.since = matcher, read, now
+		return nil
+	}
+	if now.Before(s.since.Add(s.window)) {
+		return nil
+	}
+	return matcher
+}
+
+// deadline returns the earliest of deadline and when the pending condition, if
+// any, will be stable, so that Expect wakes up to confirm it.
+func (s *stability) deadline(deadline time.Time) time.Time {
+	if s.pending == nil {
+		return deadline
+	}
+	if stable := s.since.Add(s.window); deadline.IsZero() || stable.Before(deadline) {
+		return stable
+	}
+	return deadline
+}
+
+// WithDeadline sets a read timeout for an Expect statement that elapses at t,
+// e.g. so that each step of an operation shares the time left in its budget.
+// The remaining time is computed when Expect is called; if t has already
+// passed, Expect times out without reading, see ErrTimeout.
+func WithDeadline(t time.Time) ExpectOpt {
+	return func(opts *ExpectOpts) error {
+		return WithTimeout(time.Until(t))(opts)
+	}
+}
+
+// WithProgressLog logs the tail of the content read so far to Console's logger
+// every interval while an Expect is waiting, until a condition is met or it
+// times out, e.g. to tell what a slow Expect in CI is stuck on.
+func WithProgressLog(interval time.Duration) ExpectOpt {
+	return func(opts *ExpectOpts) error {
+		opts.ProgressLog = interval
+		return nil
+	}
+}
+
+// WithSilentObservers skips Console's expect and match observers for a single
+// Expect, e.g. to keep an Expect made in a loop out of the logs. Send
+// observers are separate and still called for sends made during the Expect,
+// such as those of WithAutoResponder.
+func WithSilentObservers() ExpectOpt {
+	return func(opts *ExpectOpts) error {
+		opts.silentObservers = true
+		return nil
+	}
+}
+
 // ConsoleCallback is a callback function to execute if a match is found for
 // the chained matcher.
 type ConsoleCallback func(buf *bytes.Buffer) error
@@ -59,171 +252,1267 @@ func (eo ExpectOpt) Then(f ConsoleCallback) ExpectOpt {
 	}
 }
 
-// ExpectOpts provides additional options on Expect.
-type ExpectOpts struct {
-	Matchers    []Matcher
-	ReadTimeout *time.Duration
+// Within returns an Expect condition that only matches within timeout of the
+// start of Expect, so that conditions in a single Expect can expire
+// independently. Once a condition expires it is ignored, and Expect keeps
+// waiting for the remaining conditions. If every condition has expired, Expect
+// returns a timeout error as if the Expect itself timed out. A timeout for the
+// whole Expect still applies to conditions with a longer timeout.
+func (eo ExpectOpt) Within(timeout time.Duration) ExpectOpt {
+	return func(opts *ExpectOpts) error {
+		var options ExpectOpts
+		err := eo(&options)
+		if err != nil {
+			return err
+		}
+
+		deadline := time.Now().Add(timeout)
+		for _, matcher := range options.Matchers {
+			opts.Matchers = append(opts.Matchers, &timedMatcher{
+				matcher: matcher,
+				expires: deadline,
+			})
+		}
+		return nil
+	}
+}
+
+// Map returns Expect conditions that match like the conditions of opt, and
+// have ExpectValue return the result of fn for the text that met them, e.g. to
+// parse a number matched by a Regexp without matching it again. fn is called
+// with the located text that met the condition, like Match.Groups[0], or all
+// the content read if the condition doesn't locate its matches, such as EOF.
+func Map(opt ExpectOpt, fn func(match string) (interface{}, error)) ExpectOpt {
+	return func(opts *ExpectOpts) error {
+		var options ExpectOpts
+		err := opt(&options)
+		if err != nil {
+			return err
+		}
+
+		for _, matcher := range options.Matchers {
+			opts.Matchers = append(opts.Matchers, &mapMatcher{
+				matcher: matcher,
+				fn:      fn,
+			})
+		}
+		return nil
+	}
+}
+
+// ExpectOpts provides additional options on Expect.
+type ExpectOpts struct {
+	Matchers    []Matcher
+	ReadTimeout *time.Duration
+	ProgressLog time.Duration
+
+	// screen is set by ExpectScreen to match against the rendered screen.
+	screen bool
+
+	// silence is set by ExpectSilence to succeed once the timeout elapses
+	// without reading anything.
+	silence bool
+
+	// silentObservers is set by WithSilentObservers to skip Console's expect
+	// and match observers.
+	silentObservers bool
+
+	// banner is set while Console's startup banner is read ahead of an
+	// Expect, to keep that read out of Console's stats and observers.
+	banner bool
+
+	// startOnFirstByte is set by WithStartTimeoutOnFirstByte to restart the
+	// read timeout once the first rune is read.
+	startOnFirstByte bool
+
+	// stableFor is set by WithStableFor to how long a met condition must stay
+	// met without more content being read.
+	stableFor time.Duration
+
+	// maxFrameSize is set by WithMaxFrameSize to the largest payload
+	// ExpectLengthPrefixed accepts, or zero for defaultMaxFrameSize.
+	maxFrameSize int
+}
+
+// matchScreen sets Expect to match conditions against Console's screen.
+func matchScreen(opts *ExpectOpts) error {
+	opts.screen = true
+	return nil
+}
+
+// readBanner sets Expect to read Console's startup banner on behalf of
+// another Expect.
+func readBanner(opts *ExpectOpts) error {
+	opts.banner = true
+	return nil
+}
+
+// appendMatcher returns an ExpectOpt that adds matcher as a condition.
+func appendMatcher(matcher Matcher) ExpectOpt {
+	return func(opts *ExpectOpts) error {
+		opts.Matchers = append(opts.Matchers, matcher)
+		return nil
+	}
+}
+
+// expectSilence sets Expect to succeed if nothing is read before it times
+// out.
+func expectSilence(opts *ExpectOpts) error {
+	opts.silence = true
+	return nil
+}
+
+// Match sequentially calls Match on all matchers in ExpectOpts and returns the
+// first matcher if a match exists, otherwise nil.
+func (eo ExpectOpts) Match(v interface{}) Matcher {
+	for _, matcher := range eo.Matchers {
+		if matcher.Match(v) {
+			return matcher
+		}
+	}
+	return nil
+}
+
+// events returns the channels of matchers that can be met by an event other
+// than content read from Console's tty.
+func (eo ExpectOpts) events() []<-chan struct{} {
+	var events []<-chan struct{}
+	for _, matcher := range eo.Matchers {
+		em, ok := matcher.(eventMatcher)
+		if !ok {
+			continue
+		}
+		if eventC := em.events(); eventC != nil {
+			events = append(events, eventC)
+		}
+	}
+	return events
+}
+
+// expired reports whether every matcher has a deadline that is not after now,
+// so that none of them can match anymore.
+func (eo ExpectOpts) expired(now time.Time) bool {
+	if len(eo.Matchers) == 0 {
+		return false
+	}
+	for _, matcher := range eo.Matchers {
+		deadline := matcherDeadline(matcher)
+		if deadline.IsZero() || deadline.After(now) {
+			return false
+		}
+	}
+	return true
+}
+
+// nextDeadline returns the earliest of deadline and the deadlines of matchers
+// that have not expired by now, at which point the conditions need to be
+// evaluated again.
+func (eo ExpectOpts) nextDeadline(deadline, now time.Time) time.Time {
+	for _, matcher := range eo.Matchers {
+		d := matcherDeadline(matcher)
+		if d.After(now) && (deadline.IsZero() || d.Before(deadline)) {
+			deadline = d
+		}
+	}
+	return deadline
+}
+
+// deadlineMatcher is implemented by matchers that expire, see Within.
+type deadlineMatcher interface {
+	deadline() time.Time
+}
+
+// matcherDeadline returns when matcher expires, or the zero time if it never
+// does.
+func matcherDeadline(matcher Matcher) time.Time {
+	dm, ok := matcher.(deadlineMatcher)
+	if !ok {
+		return time.Time{}
+	}
+	return dm.deadline()
+}
+
+// locate returns where matcher matches in buf if it is a locator, otherwise
+// nil.
+func locate(matcher Matcher, buf []byte) []int {
+	l, ok := matcher.(locator)
+	if !ok {
+		return nil
+	}
+	return l.locate(buf)
+}
+
+// abort returns the error of the first matcher that can no longer match buf,
+// or nil if all of them still may.
+func (eo ExpectOpts) abort(buf *bytes.Buffer) error {
+	for _, matcher := range eo.Matchers {
+		if err := abort(matcher, buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// aborter is implemented by matchers that can tell when content read from
+// Console's tty rules out a match, so that Expect fails rather than waiting
+// for its timeout.
+type aborter interface {
+	// abort returns a non-nil error if buf can no longer be matched.
+	abort(buf *bytes.Buffer) error
+}
+
+// abort returns the error from matcher if it is an aborter, otherwise nil.
+func abort(matcher Matcher, buf *bytes.Buffer) error {
+	a, ok := matcher.(aborter)
+	if !ok {
+		return nil
+	}
+	return a.abort(buf)
+}
+
+// eventMatcher is implemented by matchers that can be met by an event other
+// than content read from Console's tty, such as a process exiting. The channel
+// returned by events is closed when the event occurs, so that a blocked
+// Expect can evaluate its conditions again.
+type eventMatcher interface {
+	events() <-chan struct{}
+}
+
+// MatchReason describes which kind of condition ended an Expect.
+type MatchReason int
+
+const (
+	// MatchedPattern means content read from Console's tty matched a
+	// condition.
+	MatchedPattern MatchReason = iota
+
+	// MatchedEOF means reading from Console's tty returned an expected error,
+	// such as io.EOF from EOF or PTSClosed.
+	MatchedEOF
+
+	// MatchedProcessExit means a process watched by ProcessExit exited.
+	MatchedProcessExit
+)
+
+// matchReason returns the kind of condition matcher is.
+func matchReason(matcher Matcher) MatchReason {
+	switch m := matcher.(type) {
+	case *callbackMatcher:
+		return matchReason(m.matcher)
+	case *timedMatcher:
+		return matchReason(m.matcher)
+	case *mapMatcher:
+		return matchReason(m.matcher)
+	case *errorMatcher, *pathErrorMatcher:
+		return MatchedEOF
+	case *processExitMatcher:
+		return MatchedProcessExit
+	default:
+		return MatchedPattern
+	}
+}
+
+// CallbackMatcher is a matcher that provides a Callback function.
+type CallbackMatcher interface {
+	// Callback executes the matcher's callback with the content buffer at the
+	// time of match.
+	Callback(buf *bytes.Buffer) error
+}
+
+// Matcher provides an interface for finding a match in content read from
+// Console's tty.
+type Matcher interface {
+	// Match returns true iff a match is found.
+	Match(v interface{}) bool
+	Criteria() interface{}
+}
+
+// callbackMatcher fulfills the Matcher and CallbackMatcher interface to match
+// using its embedded matcher and provide a callback function.
+type callbackMatcher struct {
+	f       ConsoleCallback
+	matcher Matcher
+}
+
+func (cm *callbackMatcher) Match(v interface{}) bool {
+	return cm.matcher.Match(v)
+}
+
+func (cm *callbackMatcher) Criteria() interface{} {
+	return cm.matcher.Criteria()
+}
+
+func (cm *callbackMatcher) events() <-chan struct{} {
+	em, ok := cm.matcher.(eventMatcher)
+	if !ok {
+		return nil
+	}
+	return em.events()
+}
+
+func (cm *callbackMatcher) locate(buf []byte) []int {
+	return locate(cm.matcher, buf)
+}
+
+func (cm *callbackMatcher) abort(buf *bytes.Buffer) error {
+	return abort(cm.matcher, buf)
+}
+
+func (cm *callbackMatcher) deadline() time.Time {
+	return matcherDeadline(cm.matcher)
+}
+
+func (cm *callbackMatcher) Callback(buf *bytes.Buffer) error {
+	cb, ok := cm.matcher.(CallbackMatcher)
+	if ok {
+		err := cb.Callback(buf)
+		if err != nil {
+			return err
+		}
+	}
+	err := cm.f(buf)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// timedMatcher fulfills the Matcher interface to match using its embedded
+// matcher until its deadline.
+type timedMatcher struct {
+	matcher Matcher
+	expires time.Time
+}
+
+func (tm *timedMatcher) Match(v interface{}) bool {
+	if !time.Now().Before(tm.expires) {
+		return false
+	}
+	return tm.matcher.Match(v)
+}
+
+func (tm *timedMatcher) Criteria() interface{} {
+	return tm.matcher.Criteria()
+}
+
+func (tm *timedMatcher) locate(buf []byte) []int {
+	return locate(tm.matcher, buf)
+}
+
+func (tm *timedMatcher) abort(buf *bytes.Buffer) error {
+	if !time.Now().Before(tm.expires) {
+		return nil
+	}
+	return abort(tm.matcher, buf)
+}
+
+func (tm *timedMatcher) deadline() time.Time {
+	return tm.expires
+}
+
+func (tm *timedMatcher) events() <-chan struct{} {
+	em, ok := tm.matcher.(eventMatcher)
+	if !ok {
+		return nil
+	}
+	return em.events()
+}
+
+func (tm *timedMatcher) Callback(buf *bytes.Buffer) error {
+	cb, ok := tm.matcher.(CallbackMatcher)
+	if !ok {
+		return nil
+	}
+	return cb.Callback(buf)
+}
+
+// idleMatcher fulfills the Matcher interface to match once content has been
+// read from Console's tty and nothing more is read for a duration.
+type idleMatcher struct {
+	idle time.Duration
+	// read is the length of the content read, and last when it last grew.
+	read int
+	last time.Time
+}
+
+func (im *idleMatcher) Match(v interface{}) bool {
+	buf, ok := v.(*bytes.Buffer)
+	if !ok || buf.Len() == 0 {
+		return false
+	}
+
+	now := time.Now()
+	if buf.Len() != im.read {
+		im.read = buf.Len()
+		im.last = now
+		return false
+	}
+	return !now.Before(im.last.Add(im.idle))
+}
+
+func (im *idleMatcher) Criteria() interface{} {
+	return im.idle
+}
+
+// deadline returns when the content read will have been idle for long enough,
+// so that Expect wakes up to match it. It is zero until content is read.
+func (im *idleMatcher) deadline() time.Time {
+	if im.last.IsZero() {
+		return time.Time{}
+	}
+	return im.last.Add(im.idle)
+}
+
+// mapMatcher fulfills the Matcher interface to match using its embedded
+// matcher, and transforms the text that met it for ExpectValue.
+type mapMatcher struct {
+	matcher Matcher
+	fn      func(match string) (interface{}, error)
+}
+
+func (mm *mapMatcher) Match(v interface{}) bool {
+	return mm.matcher.Match(v)
+}
+
+func (mm *mapMatcher) Criteria() interface{} {
+	return mm.matcher.Criteria()
+}
+
+func (mm *mapMatcher) locate(buf []byte) []int {
+	return locate(mm.matcher, buf)
+}
+
+func (mm *mapMatcher) abort(buf *bytes.Buffer) error {
+	return abort(mm.matcher, buf)
+}
+
+func (mm *mapMatcher) deadline() time.Time {
+	return matcherDeadline(mm.matcher)
+}
+
+func (mm *mapMatcher) events() <-chan struct{} {
+	em, ok := mm.matcher.(eventMatcher)
+	if !ok {
+		return nil
+	}
+	return em.events()
+}
+
+func (mm *mapMatcher) Callback(buf *bytes.Buffer) error {
+	cb, ok := mm.matcher.(CallbackMatcher)
+	if !ok {
+		return nil
+	}
+	return cb.Callback(buf)
+}
+
+// mapperOf returns the mapMatcher of matcher, looking through the matchers
+// that wrap it, or nil if it has none.
+func mapperOf(matcher Matcher) *mapMatcher {
+	switch m := matcher.(type) {
+	case *mapMatcher:
+		return m
+	case *callbackMatcher:
+		return mapperOf(m.matcher)
+	case *timedMatcher:
+		return mapperOf(m.matcher)
+	default:
+		return nil
+	}
+}
+
+// errorMatcher fulfills the Matcher interface to match a specific error.
+type errorMatcher struct {
+	err error
+}
+
+func (em *errorMatcher) Match(v interface{}) bool {
+	err, ok := v.(error)
+	if !ok {
+		return false
+	}
+	return err == em.err
+}
+
+func (em *errorMatcher) Criteria() interface{} {
+	return em.err
+}
+
+// pathErrorMatcher fulfills the Matcher interface to match a specific os.PathError.
+type pathErrorMatcher struct {
+	pathError os.PathError
+}
+
+func (em *pathErrorMatcher) Match(v interface{}) bool {
+	pathError, ok := v.(*os.PathError)
+	if !ok {
+		return false
+	}
+	return *pathError == em.pathError
+}
+
+func (em *pathErrorMatcher) Criteria() interface{} {
+	return em.pathError
+}
+
+// stringMatcher fulfills the Matcher interface to match strings against a given
+// bytes.Buffer.
+type stringMatcher struct {
+	str string
+}
+
+func (sm *stringMatcher) Match(v interface{}) bool {
+	buf, ok := v.(*bytes.Buffer)
+	if !ok {
+		return false
+	}
+	if strings.Contains(buf.String(), sm.str) {
+		return true
+	}
+	return false
+}
+
+func (sm *stringMatcher) locate(buf []byte) []int {
+	i := bytes.Index(buf, []byte(sm.str))
+	if i < 0 {
+		return nil
+	}
+	return []int{i, i + len(sm.str)}
+}
+
+func (sm *stringMatcher) Criteria() interface{} {
+	return sm.str
+}
+
+// prefixMatcher fulfills the Matcher interface to match a string at the start
+// of a given bytes.Buffer.
+type prefixMatcher struct {
+	prefix string
+}
+
+func (pm *prefixMatcher) Match(v interface{}) bool {
+	buf, ok := v.(*bytes.Buffer)
+	if !ok {
+		return false
+	}
+	return strings.HasPrefix(buf.String(), pm.prefix)
+}
+
+func (pm *prefixMatcher) abort(buf *bytes.Buffer) error {
+	content := buf.String()
+	if strings.HasPrefix(pm.prefix, content) || strings.HasPrefix(content, pm.prefix) {
+		return nil
+	}
+	return fmt.Errorf("%w: expected %q but got %q", ErrPrefixMismatch, pm.prefix, content)
+}
+
+func (pm *prefixMatcher) locate(buf []byte) []int {
+	if !bytes.HasPrefix(buf, []byte(pm.prefix)) {
+		return nil
+	}
+	return []int{0, len(pm.prefix)}
+}
+
+func (pm *prefixMatcher) Criteria() interface{} {
+	return pm.prefix
+}
+
+// promptWhitespace is the trailing whitespace tolerated after the symbol of a
+// Prompt condition.
+var promptWhitespace = []string{"", " ", "\t"}
+
+// promptMatcher fulfills the Matcher interface to match a prompt symbol at the
+// end of a given bytes.Buffer.
+type promptMatcher struct {
+	symbol string
+}
+
+func (pm *promptMatcher) Match(v interface{}) bool {
+	buf, ok := v.(*bytes.Buffer)
+	if !ok {
+		return false
+	}
+	return pm.locate(buf.Bytes()) != nil
+}
+
+func (pm *promptMatcher) locate(buf []byte) []int {
+	for _, ws := range promptWhitespace {
+		if suffix := pm.symbol + ws; bytes.HasSuffix(buf, []byte(suffix)) {
+			return []int{len(buf) - len(suffix), len(buf)}
+		}
+	}
+	return nil
+}
+
+func (pm *promptMatcher) Criteria() interface{} {
+	return pm.symbol
+}
+
+// regexpMatcher fulfills the Matcher interface to match Regexp against a given
+// bytes.Buffer.
+type regexpMatcher struct {
+	re *regexp.Regexp
+}
+
+func (rm *regexpMatcher) Match(v interface{}) bool {
+	buf, ok := v.(*bytes.Buffer)
+	if !ok {
+		return false
+	}
+	return rm.re.Match(buf.Bytes())
+}
+
+func (rm *regexpMatcher) locate(buf []byte) []int {
+	return rm.re.FindSubmatchIndex(buf)
+}
+
+func (rm *regexpMatcher) Criteria() interface{} {
+	return rm.re
+}
+
+// RawBytes holds the bytes of a rune as read from Console's tty, before being
+// decoded as UTF-8. Expect passes RawBytes to Matcher.Match after each rune
+// read, so that matchers can match binary content that isn't valid UTF-8.
+type RawBytes []byte
+
+// MatchEngine matches the output of Console's tty incrementally, for content
+// that the built-in conditions can't describe, such as binary frames. Unlike a
+// Matcher, which is passed the whole content read after each rune, an engine
+// only sees each byte once and must keep whatever state it needs.
+//
+// Feed is called by Expect with the raw bytes of each rune as it is read, in
+// order and from a single goroutine, before they are decoded as UTF-8 or
+// rewritten by read mutators. It reports whether the bytes fed so far form a
+// match, at which point Expect returns the content read. An engine is only fed
+// during the Expect calls it is passed to, and isn't reset between them.
+type MatchEngine interface {
+	Feed(p []byte) bool
+}
+
+// engineMatcher fulfills the Matcher interface to feed the raw bytes read from
+// Console's tty to a MatchEngine.
+type engineMatcher struct {
+	engine MatchEngine
+}
+
+func (em *engineMatcher) Match(v interface{}) bool {
+	raw, ok := v.(RawBytes)
+	return ok && em.engine.Feed(raw)
+}
+
+func (em *engineMatcher) Criteria() interface{} {
+	return em.engine
+}
+
+// Cursor is the position of the cursor on the screen maintained by
+// WithScreen. Rows and columns are 0-based from the top-left cell, unlike the
+// 1-based coordinates of cursor-positioning sequences, so "\x1b[1;1H" moves
+// the cursor to Cursor{Row: 0, Col: 0}. ExpectScreen passes the Cursor to
+// Matcher.Match whenever the screen changes.
+type Cursor struct {
+	Row int
+	Col int
+}
+
+// cursorMatcher fulfills the Matcher interface to match the position of the
+// screen's cursor.
+type cursorMatcher struct {
+	cursor Cursor
+}
+
+func (cm *cursorMatcher) Match(v interface{}) bool {
+	cursor, ok := v.(Cursor)
+	return ok && cursor == cm.cursor
+}
+
+func (cm *cursorMatcher) Criteria() interface{} {
+	return cm.cursor
+}
+
+// binaryHashBase is the base of the Rabin-Karp rolling hash, computed modulo
+// 2^32.
+const binaryHashBase = 16777619
+
+// binaryMatcher fulfills the Matcher interface to match a byte sequence in the
+// raw bytes read from Console's tty, using a Rabin-Karp rolling hash over a
+// window the size of the sequence.
+type binaryMatcher struct {
+	needle []byte
+	// needleHash is the hash of needle, and pow is binaryHashBase^(len-1),
+	// the weight of the oldest byte in the window.
+	needleHash uint32
+	pow        uint32
+	window     []byte
+	pos        int
+	filled     int
+	hash       uint32
+}
+
+func newBinaryMatcher(needle []byte) *binaryMatcher {
+	bm := &binaryMatcher{
+		needle: needle,
+		window: make([]byte, len(needle)),
+		pow:    1,
+	}
+	for i, b := range needle {
+		bm.needleHash = bm.needleHash*binaryHashBase + uint32(b)
+		if i > 0 {
+			bm.pow *= binaryHashBase
+		}
+	}
+	return bm
+}
+
+func (bm *binaryMatcher) Match(v interface{}) bool {
+	raw, ok := v.(RawBytes)
+	if !ok {
+		return false
+	}
+	if len(bm.needle) == 0 {
+		return true
+	}
+	for _, b := range raw {
+		if bm.push(b) {
+			return true
+		}
+	}
+	return false
+}
+
+// push adds b to the window and reports whether the window now holds the
+// needle.
+func (bm *binaryMatcher) push(b byte) bool {
+	n := len(bm.needle)
+	if bm.filled == n {
+		bm.hash -= uint32(bm.window[bm.pos]) * bm.pow
+	} else {
+		bm.filled++
+	}
+	bm.hash = bm.hash*binaryHashBase + uint32(b)
+	bm.window[bm.pos] = b
+	bm.pos = (bm.pos + 1) % n
+
+	if bm.filled < n || bm.hash != bm.needleHash {
+		return false
+	}
+
+	// Rule out hash collisions. The oldest byte in the window is at pos.
+	tail := n - bm.pos
+	return bytes.Equal(bm.window[bm.pos:], bm.needle[:tail]) &&
+		bytes.Equal(bm.window[:bm.pos], bm.needle[tail:])
+}
+
+func (bm *binaryMatcher) Criteria() interface{} {
+	return bm.needle
+}
+
+// bytesMatcher fulfills the Matcher interface to match a byte sequence in the
+// raw bytes read from Console's tty.
+type bytesMatcher struct {
+	p []byte
+	// window holds the bytes read most recently that may still start an
+	// occurrence of p.
+	window []byte
+}
+
+func (bm *bytesMatcher) Match(v interface{}) bool {
+	raw, ok := v.(RawBytes)
+	if !ok {
+		return false
+	}
+	if len(bm.p) == 0 {
+		return true
+	}
+
+	bm.window = append(bm.window, raw...)
+	if bytes.Contains(bm.window, bm.p) {
+		return true
+	}
+	if keep := len(bm.p) - 1; len(bm.window) > keep {
+		bm.window = append(bm.window[:0], bm.window[len(bm.window)-keep:]...)
+	}
+	return false
+}
+
+func (bm *bytesMatcher) Criteria() interface{} {
+	return bm.p
+}
+
+// progressInterval is how many bytes are read between the calls of the
+// callback of ExpectEOFProgress.
+const progressInterval = 32 * 1024
+
+// progressMatcher fulfills the Matcher interface to count the bytes read from
+// Console's tty without ever matching.
+type progressMatcher struct {
+	cb       func(n int64)
+	n        int64
+	reported int64
+}
+
+func (pm *progressMatcher) Match(v interface{}) bool {
+	raw, ok := v.(RawBytes)
+	if !ok {
+		return false
+	}
+	pm.n += int64(len(raw))
+	if pm.n-pm.reported >= progressInterval {
+		pm.report()
+	}
+	return false
+}
+
+// report calls the callback with the bytes counted so far, unless they were
+// already reported.
+func (pm *progressMatcher) report() {
+	if pm.n == pm.reported {
+		return
+	}
+	pm.reported = pm.n
+	pm.cb(pm.n)
+}
+
+func (pm *progressMatcher) Criteria() interface{} {
+	return "progress"
+}
+
+// tokenMatcher fulfills the Matcher interface to split the content read into
+// tokens, and match the first token accepted by match, see ExpectToken.
+type tokenMatcher struct {
+	split bufio.SplitFunc
+	match func(token []byte) bool
+	// off is where the next token starts in the content read.
+	off   int
+	final bool
+	token []byte
+	err   error
+}
+
+func (tm *tokenMatcher) Match(v interface{}) bool {
+	buf, ok := v.(*bytes.Buffer)
+	if !ok {
+		return false
+	}
+	return tm.scan(buf.Bytes(), false)
+}
+
+// scan splits the tokens of b after those already split, and reports whether
+// one was accepted or the split function failed.
+func (tm *tokenMatcher) scan(b []byte, atEOF bool) bool {
+	if tm.off > len(b) {
+		// The content read was rewritten, e.g. by a ReadMutator.
+		tm.off = len(b)
+	}
+	for !tm.final && (tm.off < len(b) || atEOF) {
+		advance, token, err := tm.split(b[tm.off:], atEOF)
+		if err == bufio.ErrFinalToken {
+			tm.final = true
+		} else if err != nil {
+			tm.err = err
+			return true
+		}
+		if advance < 0 {
+			tm.err = bufio.ErrNegativeAdvance
+			return true
+		}
+		if advance > len(b)-tm.off {
+			tm.err = bufio.ErrAdvanceTooFar
+			return true
+		}
+		tm.off += advance
+		if token != nil && tm.match(token) {
+			tm.token = append([]byte(nil), token...)
+			return true
+		}
+		if advance == 0 {
+			return false
+		}
+	}
+	return false
+}
+
+func (tm *tokenMatcher) Criteria() interface{} {
+	return "token"
+}
+
+// allMatcher fulfills the Matcher interface to match a group of ExpectOpt
+// against any value.
+type allMatcher struct {
+	options ExpectOpts
+}
+
+func (am *allMatcher) Match(v interface{}) bool {
+	var matchers []Matcher
+	met := true
+	for _, matcher := range am.options.Matchers {
+		if matcher.Match(v) {
+			// A Not may stop being met as content is read, so it is evaluated
+			// again every time rather than remembered as met.
+			if _, ok := matcher.(*notMatcher); ok {
+				matchers = append(matchers, matcher)
+			}
+			continue
+		}
+		matchers = append(matchers, matcher)
+		met = false
+	}
+
+	am.options.Matchers = matchers
+	return met
+}
+
+func (am *allMatcher) Criteria() interface{} {
+	var criterias []interface{}
+	for _, matcher := range am.options.Matchers {
+		criterias = append(criterias, matcher.Criteria())
+	}
+	return criterias
+}
+
+// All adds an Expect condition to exit if the content read from Console's tty
+// matches all of the provided ExpectOpt, in any order. Each condition of
+// expectOpts is one operand, so All(String("a", "b")) requires both "a" and
+// "b"; use Group to require either. Conditions are remembered as met once they
+// are, except for Not.
+func All(expectOpts ...ExpectOpt) ExpectOpt {
+	return func(opts *ExpectOpts) error {
+		options, err := groupOptions(expectOpts)
+		if err != nil {
+			return err
+		}
+
+		opts.Matchers = append(opts.Matchers, &allMatcher{
+			options: options,
+		})
+		return nil
+	}
+}
+
+// groupOptions returns the conditions of expectOpts.
+func groupOptions(expectOpts []ExpectOpt) (ExpectOpts, error) {
+	var options ExpectOpts
+	for _, opt := range expectOpts {
+		if err := opt(&options); err != nil {
+			return options, err
+		}
+	}
+	return options, nil
 }
 
-// Match sequentially calls Match on all matchers in ExpectOpts and returns the
-// first matcher if a match exists, otherwise nil.
-func (eo ExpectOpts) Match(v interface{}) Matcher {
-	for _, matcher := range eo.Matchers {
-		if matcher.Match(v) {
-			return matcher
-		}
+// groupMatcher fulfills the Matcher interface to match a group of ExpectOpt as
+// a single condition, which is met when any of them is.
+type groupMatcher struct {
+	options ExpectOpts
+	// last is the embedded matcher that was met most recently.
+	last Matcher
+}
+
+func (gm *groupMatcher) Match(v interface{}) bool {
+	matcher := gm.options.Match(v)
+	if matcher == nil {
+		return false
 	}
-	return nil
+	gm.last = matcher
+	return true
 }
 
-// CallbackMatcher is a matcher that provides a Callback function.
-type CallbackMatcher interface {
-	// Callback executes the matcher's callback with the content buffer at the
-	// time of match.
-	Callback(buf *bytes.Buffer) error
+func (gm *groupMatcher) locate(buf []byte) []int {
+	if gm.last == nil {
+		return nil
+	}
+	return locate(gm.last, buf)
 }
 
-// Matcher provides an interface for finding a match in content read from
-// Console's tty.
-type Matcher interface {
-	// Match returns true iff a match is found.
-	Match(v interface{}) bool
-	Criteria() interface{}
+func (gm *groupMatcher) Criteria() interface{} {
+	var criterias []interface{}
+	for _, matcher := range gm.options.Matchers {
+		criterias = append(criterias, matcher.Criteria())
+	}
+	return criterias
 }
 
-// callbackMatcher fulfills the Matcher and CallbackMatcher interface to match
-// using its embedded matcher and provide a callback function.
-type callbackMatcher struct {
-	f       ConsoleCallback
-	matcher Matcher
+// Group adds a single Expect condition that is met when any of the provided
+// ExpectOpt is met, e.g. to pass several alternatives as one operand of All,
+// Not or Sequence: All(Group(String("a"), String("b")), String("c")) is met by
+// "a" or "b", and "c".
+//
+// Combinators nest arbitrarily and are evaluated incrementally, each time
+// Expect reads a rune, against the content read so far. There is no implicit
+// precedence: the conditions passed to Expect itself are alternatives, like a
+// Group, and a combinator applies to exactly the conditions passed to it, with
+// each condition being one operand. So All(String("a", "b")) requires both
+// strings while All(Group(String("a", "b"))) requires either.
+func Group(expectOpts ...ExpectOpt) ExpectOpt {
+	return func(opts *ExpectOpts) error {
+		options, err := groupOptions(expectOpts)
+		if err != nil {
+			return err
+		}
+
+		opts.Matchers = append(opts.Matchers, &groupMatcher{
+			options: options,
+		})
+		return nil
+	}
 }
 
-func (cm *callbackMatcher) Match(v interface{}) bool {
-	return cm.matcher.Match(v)
+// notMatcher fulfills the Matcher interface to match while none of a group of
+// ExpectOpt has matched.
+type notMatcher struct {
+	options ExpectOpts
+	// content is whether the content read so far met a condition, and seen
+	// whether any other value, such as raw bytes or an error, did.
+	content bool
+	seen    bool
 }
 
-func (cm *callbackMatcher) Criteria() interface{} {
-	return cm.matcher.Criteria()
+func (nm *notMatcher) Match(v interface{}) bool {
+	matched := nm.options.Match(v) != nil
+	if _, ok := v.(*bytes.Buffer); ok {
+		nm.content = matched
+	} else if matched {
+		nm.seen = true
+	}
+	return !nm.content && !nm.seen
 }
 
-func (cm *callbackMatcher) Callback(buf *bytes.Buffer) error {
-	cb, ok := cm.matcher.(CallbackMatcher)
-	if ok {
-		err := cb.Callback(buf)
+func (nm *notMatcher) Criteria() interface{} {
+	var criterias []interface{}
+	for _, matcher := range nm.options.Matchers {
+		criterias = append(criterias, matcher.Criteria())
+	}
+	return fmt.Sprintf("not %v", criterias)
+}
+
+// Not adds an Expect condition that is met while none of the provided ExpectOpt
+// is met, e.g. All(String("a"), Not(String("b"))) to exit once "a" is read
+// without "b" having been read. Conditions on content are evaluated against the
+// content read so far, while any other condition, such as Bytes, stays met
+// once it was. Not is met before anything is read, so it is meant as an
+// operand of All or Sequence rather than a condition of its own.
+func Not(expectOpts ...ExpectOpt) ExpectOpt {
+	return func(opts *ExpectOpts) error {
+		options, err := groupOptions(expectOpts)
 		if err != nil {
 			return err
 		}
+
+		opts.Matchers = append(opts.Matchers, &notMatcher{
+			options: options,
+		})
+		return nil
 	}
-	err := cm.f(buf)
-	if err != nil {
-		return err
-	}
-	return nil
 }
 
-// errorMatcher fulfills the Matcher interface to match a specific error.
-type errorMatcher struct {
-	err error
+// sequenceMatcher fulfills the Matcher interface to match groups of ExpectOpt
+// one after the other.
+type sequenceMatcher struct {
+	steps []ExpectOpts
+	// step is the index of the next step to be met, and offset where the
+	// content it is matched against starts.
+	step   int
+	offset int
 }
 
-func (em *errorMatcher) Match(v interface{}) bool {
-	err, ok := v.(error)
+func (sm *sequenceMatcher) Match(v interface{}) bool {
+	buf, ok := v.(*bytes.Buffer)
 	if !ok {
-		return false
+		if sm.step < len(sm.steps) && sm.steps[sm.step].Match(v) != nil {
+			sm.step++
+		}
+		return sm.step == len(sm.steps)
 	}
-	return err == em.err
-}
 
-func (em *errorMatcher) Criteria() interface{} {
-	return em.err
-}
+	if sm.offset > buf.Len() {
+		sm.offset = buf.Len()
+	}
 
-// pathErrorMatcher fulfills the Matcher interface to match a specific os.PathError.
-type pathErrorMatcher struct {
-	pathError os.PathError
+	// Each step is matched against the content after the previous one, so
+	// steps are met in order, by distinct content. The next step starts where
+	// the match ends if the condition locates it, otherwise after everything
+	// read so far.
+	for sm.step < len(sm.steps) {
+		content := buf.Bytes()[sm.offset:]
+		matcher := sm.steps[sm.step].Match(bytes.NewBuffer(content))
+		if matcher == nil {
+			break
+		}
+		sm.step++
+		if loc := locate(matcher, content); loc != nil {
+			sm.offset += loc[1]
+		} else {
+			sm.offset = buf.Len()
+		}
+	}
+	return sm.step == len(sm.steps)
 }
 
-func (em *pathErrorMatcher) Match(v interface{}) bool {
-	pathError, ok := v.(*os.PathError)
-	if !ok {
-		return false
+func (sm *sequenceMatcher) Criteria() interface{} {
+	var criterias []interface{}
+	for _, step := range sm.steps {
+		var stepCriterias []interface{}
+		for _, matcher := range step.Matchers {
+			stepCriterias = append(stepCriterias, matcher.Criteria())
+		}
+		criterias = append(criterias, stepCriterias)
 	}
-	return *pathError == em.pathError
+	return criterias
 }
 
-func (em *pathErrorMatcher) Criteria() interface{} {
-	return em.pathError
+// Sequence adds an Expect condition to exit once the provided ExpectOpt have
+// been met one after the other, each by content after that of the previous
+// one, e.g. Sequence(String("login: "), String("Password: ")). Each step
+// is met when any of its conditions is, like a Group.
+func Sequence(steps ...ExpectOpt) ExpectOpt {
+	return func(opts *ExpectOpts) error {
+		sm := &sequenceMatcher{}
+		for _, step := range steps {
+			var options ExpectOpts
+			if err := step(&options); err != nil {
+				return err
+			}
+			sm.steps = append(sm.steps, options)
+		}
+
+		opts.Matchers = append(opts.Matchers, sm)
+		return nil
+	}
 }
 
-// stringMatcher fulfills the Matcher interface to match strings against a given
-// bytes.Buffer.
-type stringMatcher struct {
-	str string
+// countMatcher fulfills the Matcher interface to match only once its embedded
+// matchers have matched n times.
+type countMatcher struct {
+	n       int
+	count   int
+	offset  int
+	options ExpectOpts
+	// last is the embedded matcher that met the latest occurrence in the
+	// content from start, or nil if it wasn't met by content.
+	last  Matcher
+	start int
+	// pending is the content read since the previous occurrence, which is
+	// matched against in place of that of buf, and seen is the length of buf
+	// it has been filled from.
+	pending bytes.Buffer
+	seen    int
 }
 
-func (sm *stringMatcher) Match(v interface{}) bool {
+func (cm *countMatcher) Match(v interface{}) bool {
 	buf, ok := v.(*bytes.Buffer)
 	if !ok {
-		return false
+		if cm.options.Match(v) != nil {
+			cm.count++
+			cm.last = nil
+		}
+		return cm.count >= cm.n
 	}
-	if strings.Contains(buf.String(), sm.str) {
-		return true
+
+	// Only the content after the previous occurrence is matched against, so each
+	// occurrence is counted once. Bytes read are appended to pending as they
+	// come rather than copied from buf again, unless a read mutator shortened
+	// buf, in which case pending is filled again from what remains of it.
+	if cm.seen > buf.Len() {
+		if cm.offset > buf.Len() {
+			cm.offset = buf.Len()
+		}
+		cm.pending.Reset()
+		cm.seen = cm.offset
 	}
-	return false
+	cm.pending.Write(buf.Bytes()[cm.seen:])
+	cm.seen = buf.Len()
+
+	if matcher := cm.options.Match(&cm.pending); matcher != nil {
+		cm.count++
+		cm.last, cm.start = matcher, cm.offset
+		cm.offset = buf.Len()
+		cm.pending.Reset()
+	}
+	return cm.count >= cm.n
 }
 
-func (sm *stringMatcher) Criteria() interface{} {
-	return sm.str
+// locate returns where the n-th occurrence is in buf, with its capture groups
+// if it was met by a Regexp, once it has been counted.
+func (cm *countMatcher) locate(buf []byte) []int {
+	if cm.count < cm.n || cm.last == nil || cm.start > len(buf) {
+		return nil
+	}
+	loc := locate(cm.last, buf[cm.start:])
+	for i := range loc {
+		if loc[i] >= 0 {
+			loc[i] += cm.start
+		}
+	}
+	return loc
 }
 
-// regexpMatcher fulfills the Matcher interface to match Regexp against a given
-// bytes.Buffer.
-type regexpMatcher struct {
-	re *regexp.Regexp
+func (cm *countMatcher) Criteria() interface{} {
+	var criterias []interface{}
+	for _, matcher := range cm.options.Matchers {
+		criterias = append(criterias, matcher.Criteria())
+	}
+	return criterias
 }
 
-func (rm *regexpMatcher) Match(v interface{}) bool {
-	buf, ok := v.(*bytes.Buffer)
-	if !ok {
-		return false
+// Count adds an Expect condition to exit once the content read from Console's
+// tty has matched the provided ExpectOpt n times. Occurrences are counted
+// incrementally as content is read and do not overlap. The n-th occurrence is
+// located like the condition of opt, so that Match and ExpectValue describe
+// it, e.g. with the capture groups of a Regexp. An n that isn't positive is an
+// error.
+func Count(n int, opt ExpectOpt) ExpectOpt {
+	return func(opts *ExpectOpts) error {
+		if n <= 0 {
+			return fmt.Errorf("invalid count %d", n)
+		}
+		var options ExpectOpts
+		if err := opt(&options); err != nil {
+			return err
+		}
+
+		opts.Matchers = append(opts.Matchers, &countMatcher{
+			n:       n,
+			options: options,
+		})
+		return nil
 	}
-	return rm.re.Match(buf.Bytes())
 }
 
-func (rm *regexpMatcher) Criteria() interface{} {
-	return rm.re
+// forbidMatcher fulfills the Matcher interface to abort an Expect when its
+// embedded matcher matches, rather than to exit successfully.
+type forbidMatcher struct {
+	matcher Matcher
 }
 
-// allMatcher fulfills the Matcher interface to match a group of ExpectOpt
-// against any value.
-type allMatcher struct {
-	options ExpectOpts
+func (fm *forbidMatcher) Match(v interface{}) bool {
+	return false
 }
 
-func (am *allMatcher) Match(v interface{}) bool {
-	var matchers []Matcher
-	for _, matcher := range am.options.Matchers {
-		if matcher.Match(v) {
-			continue
-		}
-		matchers = append(matchers, matcher)
+func (fm *forbidMatcher) abort(buf *bytes.Buffer) error {
+	if !fm.matcher.Match(buf) {
+		return nil
 	}
 
-	am.options.Matchers = matchers
-	return len(matchers) == 0
+	offset := -1
+	if loc := locate(fm.matcher, buf.Bytes()); loc != nil {
+		offset = loc[0]
+	}
+	return &AbortError{
+		Matcher: fm.matcher,
+		Buffer:  buf.String(),
+		Offset:  offset,
+	}
 }
 
-func (am *allMatcher) Criteria() interface{} {
-	var criterias []interface{}
-	for _, matcher := range am.options.Matchers {
-		criterias = append(criterias, matcher.Criteria())
-	}
-	return criterias
+func (fm *forbidMatcher) Criteria() interface{} {
+	return fm.matcher.Criteria()
 }
 
-// All adds an Expect condition to exit if the content read from Console's tty
-// matches all of the provided ExpectOpt, in any order.
-func All(expectOpts ...ExpectOpt) ExpectOpt {
+// Forbid adds Expect conditions that abort the Expect with an *AbortError if
+// the content read from Console's tty matches any of the provided ExpectOpt,
+// e.g. to fail fast on "FATAL" while waiting for a prompt. Forbidden
+// conditions are evaluated after the other conditions, so content that meets
+// both exits successfully.
+func Forbid(expectOpts ...ExpectOpt) ExpectOpt {
 	return func(opts *ExpectOpts) error {
 		var options ExpectOpts
 		for _, opt := range expectOpts {
@@ -232,9 +1521,11 @@ func All(expectOpts ...ExpectOpt) ExpectOpt {
 			}
 		}
 
-		opts.Matchers = append(opts.Matchers, &allMatcher{
-			options: options,
-		})
+		for _, matcher := range options.Matchers {
+			opts.Matchers = append(opts.Matchers, &forbidMatcher{
+				matcher: matcher,
+			})
+		}
 		return nil
 	}
 }
@@ -252,8 +1543,95 @@ func String(strs ...string) ExpectOpt {
 	}
 }
 
+// Bytes adds an Expect condition to exit if the raw bytes read from Console's
+// tty contain any of the given byte sequences verbatim, like String but
+// without decoding the bytes as UTF-8, so sequences may hold invalid UTF-8.
+// Sequences are matched against the bytes as read, ignoring changes made by
+// ReadMutators.
+func Bytes(ps ...[]byte) ExpectOpt {
+	return func(opts *ExpectOpts) error {
+		for _, p := range ps {
+			opts.Matchers = append(opts.Matchers, &bytesMatcher{
+				p: p,
+			})
+		}
+		return nil
+	}
+}
+
+// Binary adds an Expect condition to exit if the raw bytes read from
+// Console's tty contain any of the given byte sequences. Bytes are matched
+// before being decoded as UTF-8, so sequences may hold arbitrary binary data.
+// Sequences are found with a rolling hash in a time linear in the bytes read,
+// and only as many bytes as the length of each sequence are kept to match
+// against, regardless of how many are read.
+func Binary(needles ...[]byte) ExpectOpt {
+	return func(opts *ExpectOpts) error {
+		for _, needle := range needles {
+			opts.Matchers = append(opts.Matchers, newBinaryMatcher(needle))
+		}
+		return nil
+	}
+}
+
+// WithMatchEngine adds an Expect condition to exit when engine reports a
+// match, see MatchEngine. It can be combined with the built-in conditions,
+// whichever is met first ending Expect.
+func WithMatchEngine(engine MatchEngine) ExpectOpt {
+	return func(opts *ExpectOpts) error {
+		opts.Matchers = append(opts.Matchers, &engineMatcher{engine})
+		return nil
+	}
+}
+
+// CursorAt adds an ExpectScreen condition to exit if the cursor of the screen
+// maintained by WithScreen is at the given 0-based row and column, such as
+// when a TUI moves it to a field that is ready for input. It never matches
+// with Expect, which doesn't interpret the content read.
+func CursorAt(row, col int) ExpectOpt {
+	return func(opts *ExpectOpts) error {
+		opts.Matchers = append(opts.Matchers, &cursorMatcher{Cursor{Row: row, Col: col}})
+		return nil
+	}
+}
+
+// Prefix adds an Expect condition to exit if the content read from Console's
+// tty starts with the given string. As soon as content that doesn't start the
+// string is read, Expect fails with an error wrapping ErrPrefixMismatch, so
+// Prefix is meant to assert what a program prints first, such as a banner.
+func Prefix(prefix string) ExpectOpt {
+	return func(opts *ExpectOpts) error {
+		opts.Matchers = append(opts.Matchers, &prefixMatcher{
+			prefix: prefix,
+		})
+		return nil
+	}
+}
+
+// Prompt adds an Expect condition to exit if the content read from Console's
+// tty ends with the given prompt symbol, such as "$", "#" or ">", optionally
+// followed by a single space or tab. Since a prompt is the last thing printed
+// before a program waits for input, the symbol is only matched at the end of
+// the content read, not wherever it appears.
+func Prompt(symbol string) ExpectOpt {
+	return func(opts *ExpectOpts) error {
+		opts.Matchers = append(opts.Matchers, &promptMatcher{
+			symbol: symbol,
+		})
+		return nil
+	}
+}
+
 // Regexp adds an Expect condition to exit if the content read from Console's
 // tty matches the given Regexp.
+//
+// The Regexp is matched against all the content read so far after each rune
+// is read, and Expect returns as soon as it matches, so `$` and `\z` match the
+// end of the content read at that point rather than the end of a line or of the
+// program's output. For example `prompt$` is met as soon as "prompt" is read,
+// even if "> " follows it; the bytes that follow are left to the next Expect.
+// Unless (?m) is set, `$` doesn't match before a newline. See RegexpSuffix to
+// only match at the end of the content read without anchoring the Regexp.
 func Regexp(res ...*regexp.Regexp) ExpectOpt {
 	return func(opts *ExpectOpts) error {
 		for _, re := range res {
@@ -265,6 +1643,38 @@ func Regexp(res ...*regexp.Regexp) ExpectOpt {
 	}
 }
 
+// oscTitle matches an OSC sequence that sets the terminal's title, with or
+// without its icon name, terminated by either BEL or ST.
+var oscTitle = regexp.MustCompile(`\x1b\][02];([^\x07\x1b]*)(?:\x07|\x1b\\)`)
+
+// OSCTitle adds an Expect condition to exit if the content read from Console's
+// tty contains an OSC sequence setting the terminal's title, such as
+// "\x1b]0;title\x07", terminated by either BEL or ST ("\x1b\\"). The title is
+// the first capture group of the Match, see ExpectTitle.
+func OSCTitle() ExpectOpt {
+	return Regexp(oscTitle)
+}
+
+// RegexpSuffix adds an Expect condition to exit if the content read from
+// Console's tty ends with a match of the given Regexp, as if it was anchored
+// with `\z`. Unlike `$` with (?m) set, a match followed by a newline or any
+// other content doesn't meet the condition. Expect returns an error if a
+// Regexp can't be anchored.
+func RegexpSuffix(res ...*regexp.Regexp) ExpectOpt {
+	return func(opts *ExpectOpts) error {
+		for _, re := range res {
+			suffix, err := regexp.Compile(`(?:` + re.String() + `)\z`)
+			if err != nil {
+				return err
+			}
+			opts.Matchers = append(opts.Matchers, &regexpMatcher{
+				re: suffix,
+			})
+		}
+		return nil
+	}
+}
+
 // RegexpPattern adds an Expect condition to exit if the content read from
 // Console's tty matches the given Regexp patterns. Expect returns an error if
 // the patterns were unsuccessful in compiling the Regexp.
@@ -316,3 +1726,35 @@ func PTSClosed(opts *ExpectOpts) error {
 	})
 	return nil
 }
+
+// ExitBanners are the messages that ShellExit treats as a session ending:
+// "logout" printed by shells, "Connection closed" printed by network clients
+// such as telnet and ftp, and the "bye" of many interactive tools. Like String,
+// they are matched anywhere in the content read, so output that contains
+// them, such as "goodbye", also ends a session.
+var ExitBanners = []string{
+	"logout",
+	"Connection closed",
+	"bye",
+	"Bye",
+}
+
+// ShellExit adds Expect conditions for the usual signs that a command or
+// session has finished: any of ExitBanners, any of the given prompts at the end
+// of the content read like Prompt, and EOF or PTSClosed. ExpectReason tells
+// whether output, MatchedPattern, or the end of the tty, MatchedEOF, ended the
+// Expect, and a MatchObserver which condition it was.
+func ShellExit(prompts ...string) ExpectOpt {
+	return func(opts *ExpectOpts) error {
+		conds := []ExpectOpt{String(ExitBanners...), EOF, PTSClosed}
+		for _, prompt := range prompts {
+			conds = append(conds, Prompt(prompt))
+		}
+		for _, cond := range conds {
+			if err := cond(opts); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
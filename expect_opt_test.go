@@ -130,6 +130,158 @@ func TestExpectOptRegexp(t *testing.T) {
 	}
 }
 
+func TestExpectOptOSCTitle(t *testing.T) {
+	tests := []struct {
+		title    string
+		data     string
+		expected bool
+		name     string
+	}{
+		{
+			"BEL terminator",
+			"prompt\x1b]0;vim - main.go\x07",
+			true,
+			"vim - main.go",
+		},
+		{
+			"ST terminator",
+			"\x1b]2;htop\x1b\\ rest",
+			true,
+			"htop",
+		},
+		{
+			"Empty title",
+			"\x1b]0;\x07",
+			true,
+			"",
+		},
+		{
+			"Icon name only",
+			"\x1b]1;icon\x07",
+			false,
+			"",
+		},
+		{
+			"Unterminated",
+			"\x1b]0;partial",
+			false,
+			"",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			var options ExpectOpts
+			err := OSCTitle()(&options)
+			require.Nil(t, err)
+
+			buf := bytes.NewBufferString(test.data)
+			matcher := options.Match(buf)
+			if !test.expected {
+				require.Nil(t, matcher)
+				return
+			}
+			require.NotNil(t, matcher)
+
+			match := newMatch(matcher, buf.Bytes())
+			require.Len(t, match.Groups, 2)
+			require.Equal(t, test.name, match.Groups[1])
+		})
+	}
+}
+
+func TestExpectOptRegexpSuffix(t *testing.T) {
+	tests := []struct {
+		title    string
+		opt      ExpectOpt
+		data     string
+		expected bool
+	}{
+		{
+			"Suffix",
+			RegexpSuffix(regexp.MustCompile(`prompt`)),
+			"user prompt",
+			true,
+		},
+		{
+			"Followed by content",
+			RegexpSuffix(regexp.MustCompile(`prompt`)),
+			"user prompt>",
+			false,
+		},
+		{
+			"Followed by newline",
+			RegexpSuffix(regexp.MustCompile(`(?m)prompt$`)),
+			"user prompt\n",
+			false,
+		},
+		{
+			"Alternation",
+			RegexpSuffix(regexp.MustCompile(`\$|#`)),
+			"$ ls\n#",
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			var options ExpectOpts
+			err := test.opt(&options)
+			require.Nil(t, err)
+
+			matcher := options.Match(bytes.NewBufferString(test.data))
+			if test.expected {
+				require.NotNil(t, matcher)
+			} else {
+				require.Nil(t, matcher)
+			}
+		})
+	}
+}
+
+// TestExpectOptRegexpStreaming checks after which rune of the content read a
+// condition anchored to its end is first met.
+func TestExpectOptRegexpStreaming(t *testing.T) {
+	tests := []struct {
+		title    string
+		opt      ExpectOpt
+		expected string
+	}{
+		{
+			"Dollar",
+			Regexp(regexp.MustCompile(`prompt$`)),
+			"prompt",
+		},
+		{
+			"Multiline dollar",
+			Regexp(regexp.MustCompile(`(?m)prompt$`)),
+			"prompt",
+		},
+		{
+			"Suffix",
+			RegexpSuffix(regexp.MustCompile(`prompt> `)),
+			"prompt> ",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			var options ExpectOpts
+			err := test.opt(&options)
+			require.Nil(t, err)
+
+			buf := new(bytes.Buffer)
+			for _, r := range "prompt> more\n" {
+				buf.WriteRune(r)
+				if options.Match(buf) != nil {
+					break
+				}
+			}
+			require.Equal(t, test.expected, buf.String())
+		})
+	}
+}
+
 func TestExpectOptRegexpPattern(t *testing.T) {
 	tests := []struct {
 		title    string
@@ -403,3 +555,435 @@ func TestExpectOptAll(t *testing.T) {
 		})
 	}
 }
+
+func TestExpectOptCombinators(t *testing.T) {
+	tests := []struct {
+		title    string
+		opt      ExpectOpt
+		data     string
+		expected int
+	}{
+		{
+			"All without forbidden string",
+			All(String("a"), Not(String("b"))),
+			"xxa",
+			3,
+		},
+		{
+			"All after forbidden string",
+			All(String("a"), Not(String("b"))),
+			"xbxa",
+			-1,
+		},
+		{
+			"All with either string",
+			All(Group(String("a"), String("b")), String("c")),
+			"bc",
+			2,
+		},
+		{
+			"All with both strings",
+			All(String("a", "b"), String("c")),
+			"bc",
+			-1,
+		},
+		{
+			"Sequence in order",
+			Sequence(String("login: "), String("Password: ")),
+			"login: Password: ",
+			17,
+		},
+		{
+			"Sequence out of order",
+			Sequence(String("Password: "), String("login: ")),
+			"login: Password: ",
+			-1,
+		},
+		{
+			"Sequence of nested combinators",
+			Sequence(All(String("user"), String("host")), Group(String("$ "), String("# "))),
+			"host user # ",
+			12,
+		},
+		{
+			"Sequence of nested combinators before any step",
+			Sequence(All(String("user"), String("host")), Group(String("$ "), String("# "))),
+			"# host user",
+			-1,
+		},
+		{
+			"Nested sequences",
+			Sequence(Sequence(String("a"), String("b")), String("c")),
+			"acbc",
+			4,
+		},
+		{
+			"All of a sequence and not",
+			All(Sequence(String("a"), String("b")), Not(Group(String("x"), String("y")))),
+			"ayb",
+			-1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			var options ExpectOpts
+			err := test.opt(&options)
+			require.Nil(t, err)
+
+			// Feed the buffer one byte at a time, as Expect does.
+			buf := new(bytes.Buffer)
+			matched := -1
+			for i := 0; i < len(test.data); i++ {
+				err = buf.WriteByte(test.data[i])
+				require.Nil(t, err)
+
+				if options.Match(buf) != nil {
+					matched = i + 1
+					break
+				}
+			}
+			require.Equal(t, test.expected, matched)
+		})
+	}
+}
+
+func TestExpectOptCount(t *testing.T) {
+	tests := []struct {
+		title    string
+		opt      ExpectOpt
+		data     string
+		expected int
+	}{
+		{
+			"Fifth occurrence",
+			Count(5, String(".")),
+			".......",
+			5,
+		},
+		{
+			"Not enough occurrences",
+			Count(5, String(".")),
+			"...",
+			-1,
+		},
+		{
+			"Multi-byte needle",
+			Count(2, String("tick")),
+			"tick tock tick tock",
+			14,
+		},
+		{
+			"Regexp needle",
+			Count(3, RegexpPattern(`[0-9]%`)),
+			"1% 2% 3% 4%",
+			8,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			var options ExpectOpts
+			err := test.opt(&options)
+			require.Nil(t, err)
+
+			// Feed the buffer one byte at a time, as Expect does.
+			buf := new(bytes.Buffer)
+			matched := -1
+			for i := 0; i < len(test.data); i++ {
+				err = buf.WriteByte(test.data[i])
+				require.Nil(t, err)
+
+				if options.Match(buf) != nil {
+					matched = i + 1
+					break
+				}
+			}
+			require.Equal(t, test.expected, matched)
+		})
+	}
+}
+
+func TestExpectOptCountMutated(t *testing.T) {
+	var options ExpectOpts
+	err := Count(2, String("ok"))(&options)
+	require.Nil(t, err)
+
+	buf := bytes.NewBufferString("ok")
+	require.True(t, options.Match(buf) == nil)
+
+	// A read mutator removes what was read after the first occurrence.
+	buf.WriteString("\x1b[0m")
+	require.True(t, options.Match(buf) == nil)
+	buf.Truncate(2)
+	require.True(t, options.Match(buf) == nil)
+
+	buf.WriteString("ok")
+	require.NotNil(t, options.Match(buf))
+}
+
+func TestExpectOptCountInvalid(t *testing.T) {
+	for _, n := range []int{0, -1} {
+		var options ExpectOpts
+		err := Count(n, String("."))(&options)
+		require.Error(t, err, "count %d", n)
+	}
+}
+
+func TestExpectOptBinary(t *testing.T) {
+	tests := []struct {
+		title    string
+		opt      ExpectOpt
+		data     []byte
+		expected bool
+	}{
+		{
+			"No args",
+			Binary(),
+			[]byte("Hello world"),
+			false,
+		},
+		{
+			"Single arg",
+			Binary([]byte("world")),
+			[]byte("Hello world"),
+			true,
+		},
+		{
+			"Multiple arg",
+			Binary([]byte("other"), []byte("Hello")),
+			[]byte("Hello world"),
+			true,
+		},
+		{
+			"No matches",
+			Binary([]byte("hello")),
+			[]byte("Hello world"),
+			false,
+		},
+		{
+			"Invalid UTF-8",
+			Binary([]byte{0xff, 0x00, 0xfe}),
+			[]byte{0x80, 0xff, 0xff, 0x00, 0xfe, 0x81},
+			true,
+		},
+		{
+			"Overlapping prefix",
+			Binary([]byte("aab")),
+			[]byte("aaab"),
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			var options ExpectOpts
+			err := test.opt(&options)
+			require.Nil(t, err)
+
+			var matcher Matcher
+			for _, b := range test.data {
+				matcher = options.Match(RawBytes{b})
+				if matcher != nil {
+					break
+				}
+			}
+			if test.expected {
+				require.NotNil(t, matcher)
+			} else {
+				require.Nil(t, matcher)
+			}
+
+			// The decoded buffer is never matched against.
+			require.Nil(t, options.Match(bytes.NewBuffer(test.data)))
+		})
+	}
+}
+
+func TestExpectOptBytes(t *testing.T) {
+	tests := []struct {
+		title    string
+		opt      ExpectOpt
+		data     []RawBytes
+		expected bool
+	}{
+		{
+			"No args",
+			Bytes(),
+			[]RawBytes{[]byte("Hello"), []byte(" world")},
+			false,
+		},
+		{
+			"Single arg",
+			Bytes([]byte("lo wo")),
+			[]RawBytes{[]byte("Hello"), []byte(" world")},
+			true,
+		},
+		{
+			"Multiple arg",
+			Bytes([]byte("other"), []byte("world")),
+			[]RawBytes{[]byte("Hello"), []byte(" world")},
+			true,
+		},
+		{
+			"No matches",
+			Bytes([]byte("hello")),
+			[]RawBytes{[]byte("Hello"), []byte(" world")},
+			false,
+		},
+		{
+			"Invalid UTF-8",
+			Bytes([]byte{'a', 0xff, 'b'}),
+			[]RawBytes{{'a'}, {0xff}, {'b'}},
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			var options ExpectOpts
+			err := test.opt(&options)
+			require.Nil(t, err)
+
+			var matcher Matcher
+			for _, raw := range test.data {
+				matcher = options.Match(raw)
+				if matcher != nil {
+					break
+				}
+			}
+			if test.expected {
+				require.NotNil(t, matcher)
+			} else {
+				require.Nil(t, matcher)
+			}
+		})
+	}
+}
+
+func TestExpectOptPrompt(t *testing.T) {
+	tests := []struct {
+		title    string
+		opt      ExpectOpt
+		data     string
+		expected bool
+	}{
+		{
+			"Symbol",
+			Prompt("$"),
+			"user@host:~$",
+			true,
+		},
+		{
+			"Trailing space",
+			Prompt("$"),
+			"user@host:~$ ",
+			true,
+		},
+		{
+			"Trailing tab",
+			Prompt("#"),
+			"root@host:~#\t",
+			true,
+		},
+		{
+			"Too much whitespace",
+			Prompt("$"),
+			"user@host:~$  ",
+			false,
+		},
+		{
+			"Not at the end",
+			Prompt(">"),
+			"> output",
+			false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			var options ExpectOpts
+			err := test.opt(&options)
+			require.Nil(t, err)
+
+			buf := new(bytes.Buffer)
+			_, err = buf.WriteString(test.data)
+			require.Nil(t, err)
+
+			matcher := options.Match(buf)
+			if test.expected {
+				require.NotNil(t, matcher)
+			} else {
+				require.Nil(t, matcher)
+			}
+		})
+	}
+}
+
+func TestExpectOptEarliest(t *testing.T) {
+	tests := []struct {
+		title    string
+		opt      ExpectOpt
+		data     string
+		expected interface{}
+	}{
+		{
+			"No args",
+			Earliest(),
+			"Hello world",
+			nil,
+		},
+		{
+			"No matches",
+			Earliest("hello", "World"),
+			"Hello world",
+			nil,
+		},
+		{
+			"Earliest ending wins",
+			Earliest("world", "lo"),
+			"Hello world",
+			"lo",
+		},
+		{
+			"Overlapping needles",
+			Earliest("he", "she", "hers"),
+			"ushers",
+			"she",
+		},
+		{
+			"Needle in failed partial match",
+			Earliest("abcd", "bc"),
+			"abce",
+			"bc",
+		},
+		{
+			"Multi-byte runes",
+			Earliest("ñu", "añ"),
+			"mañana",
+			"añ",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			var options ExpectOpts
+			err := test.opt(&options)
+			require.Nil(t, err)
+
+			var matcher Matcher
+			for _, b := range []byte(test.data) {
+				matcher = options.Match(RawBytes{b})
+				if matcher != nil {
+					break
+				}
+			}
+			if test.expected == nil {
+				require.Nil(t, matcher)
+				return
+			}
+			require.NotNil(t, matcher)
+			require.Equal(t, test.expected, matcher.Criteria())
+		})
+	}
+}
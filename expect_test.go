@@ -16,6 +16,9 @@ package expect
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -23,11 +26,15 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime/debug"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"testing"
 	"time"
+	"unicode/utf8"
 )
 
 var (
@@ -39,7 +46,7 @@ type Survey struct {
 	Answer string
 }
 
-func Prompt(in io.Reader, out io.Writer) error {
+func prompt(in io.Reader, out io.Writer) error {
 	reader := bufio.NewReader(in)
 
 	for _, survey := range []Survey{
@@ -134,7 +141,7 @@ func TestExpectf(t *testing.T) {
 		c.ExpectEOF()
 	}()
 
-	err = Prompt(c.Tty(), c.Tty())
+	err = prompt(c.Tty(), c.Tty())
 	if err != nil {
 		t.Errorf("Expected no error but got '%s'", err)
 	}
@@ -162,7 +169,7 @@ func TestExpect(t *testing.T) {
 		c.ExpectEOF()
 	}()
 
-	err = Prompt(c.Tty(), c.Tty())
+	err = prompt(c.Tty(), c.Tty())
 	if err != nil {
 		t.Errorf("Expected no error but got '%s'", err)
 	}
@@ -171,6 +178,48 @@ func TestExpect(t *testing.T) {
 	wg.Wait()
 }
 
+func TestWaitFor(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	defer testCloser(t, c)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c.ExpectString("What is 1+1?")
+		c.WaitFor("2", String("What is Netflix backwards?"))
+		c.WaitFor("xilfteN", EOF, PTSClosed)
+	}()
+
+	err = prompt(c.Tty(), c.Tty())
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	testCloser(t, c.Tty())
+	wg.Wait()
+}
+
+func TestWaitForSendError(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewConsole()
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	testCloser(t, c)
+
+	_, err = c.WaitFor("2", String("What is Netflix backwards?"))
+	var sendErr *SendError
+	if !errors.As(err, &sendErr) {
+		t.Errorf("Expected error to be a SendError but got '%s' instead", err)
+	}
+}
+
 func TestExpectOutput(t *testing.T) {
 	t.Parallel()
 
@@ -189,94 +238,1727 @@ func TestExpectOutput(t *testing.T) {
 		c.ExpectEOF()
 	}()
 
-	err = Prompt(c.Tty(), c.Tty())
-	if err == nil || err != ErrWrongAnswer {
-		t.Errorf("Expected error '%s' but got '%s' instead", ErrWrongAnswer, err)
+	err = prompt(c.Tty(), c.Tty())
+	if err == nil || err != ErrWrongAnswer {
+		t.Errorf("Expected error '%s' but got '%s' instead", ErrWrongAnswer, err)
+	}
+	testCloser(t, c.Tty())
+	wg.Wait()
+}
+
+func TestExpectDefaultTimeout(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewTestConsole(t, WithDefaultTimeout(0))
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	defer testCloser(t, c)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		prompt(c.Tty(), c.Tty())
+	}()
+
+	_, err = c.ExpectString("What is 1+2?")
+	if err == nil || !strings.Contains(err.Error(), "i/o timeout") {
+		t.Errorf("Expected error to contain 'i/o timeout' but got '%s' instead", err)
+	}
+
+	// Close to unblock Prompt and wait for the goroutine to exit.
+	c.Tty().Close()
+	wg.Wait()
+}
+
+func TestExpectTimeout(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	defer testCloser(t, c)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		prompt(c.Tty(), c.Tty())
+	}()
+
+	_, err = c.Expect(String("What is 1+2?"), WithTimeout(0))
+	if err == nil || !strings.Contains(err.Error(), "i/o timeout") {
+		t.Errorf("Expected error to contain 'i/o timeout' but got '%s' instead", err)
+	}
+
+	// Close to unblock Prompt and wait for the goroutine to exit.
+	c.Tty().Close()
+	wg.Wait()
+}
+
+func TestExpectWithDeadline(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	defer testCloser(t, c)
+
+	_, err = c.Tty().WriteString("Hello world")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+
+	// A past deadline fails without reading.
+	_, err = c.Expect(String("Hello"), WithDeadline(time.Now().Add(-time.Second)))
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("Expected error '%s' but got '%v' instead", ErrTimeout, err)
+	}
+
+	got, err := c.Expect(String("world"), WithDeadline(time.Now().Add(time.Second)))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if got != "Hello world" {
+		t.Errorf("Expected '%s' to equal '%s'", got, "Hello world")
+	}
+}
+
+func TestExpectTimeoutTrickle(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	defer testCloser(t, c)
+
+	donec := make(chan struct{})
+	defer close(donec)
+	go func() {
+		for {
+			select {
+			case <-donec:
+				return
+			case <-time.After(10 * time.Millisecond):
+				c.Tty().WriteString(".")
+			}
+		}
+	}()
+
+	// Each byte arrives well within the timeout, but the timeout bounds the whole
+	// call.
+	start := time.Now()
+	_, err = c.Expect(String("never printed"), WithTimeout(200*time.Millisecond))
+	elapsed := time.Since(start)
+	if err == nil || !strings.Contains(err.Error(), "i/o timeout") {
+		t.Errorf("Expected error to contain 'i/o timeout' but got '%s' instead", err)
+	}
+	if !os.IsTimeout(err) {
+		t.Errorf("Expected error to be a timeout but got '%s' instead", err)
+	}
+	if elapsed > 400*time.Millisecond {
+		t.Errorf("Expected Expect to return at its deadline but it took %s", elapsed)
+	}
+}
+
+func TestExpectWithin(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	defer testCloser(t, c)
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		c.Tty().WriteString("retrying ready")
+	}()
+
+	// The banner arrives after its condition expired, which doesn't fail the
+	// Expect while another condition may still match.
+	out, err := c.Expect(String("retrying").Within(50*time.Millisecond), String("ready").Within(5*time.Second))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if out != "retrying ready" {
+		t.Errorf("Expected '%s' to equal '%s'", out, "retrying ready")
+	}
+
+	// Once every condition expired, Expect times out.
+	start := time.Now()
+	_, err = c.Expect(String("never printed").Within(50*time.Millisecond), String("nor this").Within(100*time.Millisecond))
+	elapsed := time.Since(start)
+	if !os.IsTimeout(err) {
+		t.Errorf("Expected error to be a timeout but got '%v' instead", err)
+	}
+	if elapsed < 100*time.Millisecond || elapsed > 500*time.Millisecond {
+		t.Errorf("Expected Expect to return once every condition expired but it took %s", elapsed)
+	}
+}
+
+func TestExpectSilence(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	defer testCloser(t, c)
+
+	err = c.ExpectSilence(50 * time.Millisecond)
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+}
+
+func TestExpectSilenceOutput(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	defer testCloser(t, c)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		c.Tty().WriteString("Goodbye")
+	}()
+
+	err = c.ExpectSilence(100 * time.Millisecond)
+	var silenceErr *SilenceError
+	if !errors.As(err, &silenceErr) {
+		t.Fatalf("Expected a SilenceError but got '%v'", err)
+	}
+	if silenceErr.Output != "Goodbye" {
+		t.Errorf("Expected '%s' to equal '%s'", silenceErr.Output, "Goodbye")
+	}
+}
+
+func TestExpectEOFProgress(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	defer testCloser(t, c)
+
+	const size = 4 * progressInterval
+	go func() {
+		c.Tty().WriteString(strings.Repeat("x", size))
+		c.Tty().Close()
+	}()
+
+	// Draining rune by rune is slow under the race detector, so the timeout is
+	// generous.
+	var counts []int64
+	out, err := c.ExpectEOFProgress(func(n int64) {
+		counts = append(counts, n)
+	}, WithTimeout(10*time.Second))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if len(out) != size {
+		t.Errorf("Expected %d bytes but got %d", size, len(out))
+	}
+	if len(counts) < 4 {
+		t.Fatalf("Expected the callback to fire at least 4 times but got %v", counts)
+	}
+	for i := 1; i < len(counts); i++ {
+		if counts[i] <= counts[i-1] {
+			t.Errorf("Expected increasing counts but got %v", counts)
+		}
+	}
+	if last := counts[len(counts)-1]; last != size {
+		t.Errorf("Expected a final count of %d but got %d", size, last)
+	}
+}
+
+func TestReadN(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	defer testCloser(t, c)
+
+	header := []byte{0xff, 0x00, 0x01, 'H', 'D', 'R', 0x80, 0x7f}
+	_, err = c.Tty().Write(append(header, "payload"...))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+
+	p, err := c.ReadN(len(header), time.Second)
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if !bytes.Equal(p, header) {
+		t.Errorf("Expected %q to equal %q", p, header)
+	}
+
+	// Bytes after the header are left for Expect.
+	out, err := c.ExpectString("payload")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if out != "payload" {
+		t.Errorf("Expected '%s' to equal '%s'", out, "payload")
+	}
+
+	_, err = c.Tty().WriteString("abc")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	p, err = c.ReadN(8, 50*time.Millisecond)
+	if !os.IsTimeout(err) {
+		t.Errorf("Expected error to be a timeout but got '%v' instead", err)
+	}
+	if string(p) != "abc" {
+		t.Errorf("Expected '%s' to equal '%s'", p, "abc")
+	}
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("Expected a *TimeoutError but got '%v'", err)
+	}
+	if timeoutErr.Buffer != "abc" || !timeoutErr.ReceivedAnyBytes {
+		t.Errorf("Expected the error to hold the content read but got %+v", timeoutErr)
+	}
+
+	_, err = c.ReadN(-1, time.Second)
+	if err == nil {
+		t.Errorf("Expected an error for a negative number of bytes")
+	}
+}
+
+func TestExpectWithStartTimeoutOnFirstByte(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	defer testCloser(t, c)
+
+	// The program takes longer than the timeout to produce the pattern, but
+	// produces it quickly after starting up.
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		c.Tty().WriteString("starting\n")
+		time.Sleep(300 * time.Millisecond)
+		c.Tty().WriteString("ready\n")
+	}()
+
+	out, err := c.Expect(String("ready"), WithTimeout(450*time.Millisecond), WithStartTimeoutOnFirstByte())
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if out != "starting\r\nready" {
+		t.Errorf("Expected %q to equal %q", out, "starting\r\nready")
+	}
+
+	// Without output, waiting for the first byte is capped by the timeout.
+	start := time.Now()
+	_, err = c.Expect(String("ready"), WithTimeout(100*time.Millisecond), WithStartTimeoutOnFirstByte())
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("Expected a timeout but got '%v'", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected to time out after 100ms but took %s", elapsed)
+	}
+}
+
+func TestExpectWithStableFor(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	defer testCloser(t, c)
+
+	// The first chunk transiently ends like the prompt.
+	go func() {
+		c.Tty().WriteString("total: $ ")
+		time.Sleep(50 * time.Millisecond)
+		c.Tty().WriteString("42\n$ ")
+	}()
+
+	start := time.Now()
+	out, err := c.Expect(RegexpPattern(`\$ $`), WithStableFor(200*time.Millisecond))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if out != "total: $ 42\r\n$ " {
+		t.Errorf("Expected %q to equal %q", out, "total: $ 42\r\n$ ")
+	}
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+		t.Errorf("Expected the match to wait for stable output but it took %s", elapsed)
+	}
+}
+
+func TestExpectIncompleteRune(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		title    string
+		policy   IncompleteRunePolicy
+		expected string
+	}{
+		{
+			"Keep",
+			IncompleteRuneKeep,
+			"caf\u00e9 done\xc3",
+		},
+		{
+			"Replace",
+			IncompleteRuneReplace,
+			"caf\u00e9 done\ufffd",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.title, func(t *testing.T) {
+			t.Parallel()
+
+			stdout := new(bytes.Buffer)
+			c, err := newTestConsole(t, WithIncompleteRunePolicy(test.policy), WithStdout(stdout))
+			if err != nil {
+				t.Errorf("Expected no error but got '%s'", err)
+			}
+			defer testCloser(t, c)
+
+			// 0xc3 starts a 2-byte sequence that never completes.
+			_, err = c.Tty().WriteString("caf\u00e9 done\xc3")
+			if err != nil {
+				t.Errorf("Expected no error but got '%s'", err)
+			}
+			c.Tty().Close()
+
+			out, err := c.ExpectEOF()
+			if err != nil {
+				t.Errorf("Expected no error but got '%s'", err)
+			}
+			if out != test.expected {
+				t.Errorf("Expected %q to equal %q", out, test.expected)
+			}
+			if stdout.String() != test.expected {
+				t.Errorf("Expected stdout %q to equal %q", stdout.String(), test.expected)
+			}
+		})
+	}
+}
+
+func TestExpectRuneSplitAcrossProgressLog(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	defer testCloser(t, c)
+
+	// The progress log interrupts the read between the bytes of "é", which
+	// must not cut the rune short.
+	go func() {
+		c.Tty().WriteString("caf\xc3")
+		time.Sleep(100 * time.Millisecond)
+		c.Tty().WriteString("\xa9!")
+	}()
+
+	out, err := c.Expect(String("café!"), WithProgressLog(20*time.Millisecond))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if out != "café!" {
+		t.Errorf("Expected %q to equal %q", out, "café!")
+	}
+}
+
+func TestExpectAnyString(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	defer testCloser(t, c)
+
+	_, err = c.Tty().WriteString("Password: ")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+
+	matched, out, err := c.ExpectAnyString("$ ", "Password: ", "Permission denied")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if matched != "Password: " {
+		t.Errorf("Expected '%s' to equal '%s'", matched, "Password: ")
+	}
+	if out != "Password: " {
+		t.Errorf("Expected '%s' to equal '%s'", out, "Password: ")
+	}
+}
+
+func TestExpectLengthPrefixed(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	defer testCloser(t, c)
+
+	// The tty translates newlines, so the frames contain none.
+	frames := []byte{0x00, 0x00, 0x00, 0x07, 'p', 'a', 'y', 0xff, 'l', 'o', 'd'}
+	frames = append(frames, 0x03, 0x00, 'a', 'b', 'c')
+	_, err = c.Tty().Write(append(frames, "rest"...))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+
+	p, err := c.ExpectLengthPrefixed(4, true, WithTimeout(time.Second))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	expected := []byte{'p', 'a', 'y', 0xff, 'l', 'o', 'd'}
+	if !bytes.Equal(p, expected) {
+		t.Errorf("Expected %q to equal %q", p, expected)
+	}
+
+	p, err = c.ExpectLengthPrefixed(2, false, WithTimeout(time.Second))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if string(p) != "abc" {
+		t.Errorf("Expected '%s' to equal '%s'", p, "abc")
+	}
+
+	out, err := c.ExpectString("rest")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if out != "rest" {
+		t.Errorf("Expected '%s' to equal '%s'", out, "rest")
+	}
+
+	_, err = c.Tty().Write([]byte{0x00, 0x08, 'x'})
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	p, err = c.ExpectLengthPrefixed(2, true, WithTimeout(50*time.Millisecond))
+	if !os.IsTimeout(errors.Unwrap(err)) {
+		t.Errorf("Expected error to be a timeout but got '%v' instead", err)
+	}
+	if string(p) != "x" {
+		t.Errorf("Expected '%s' to equal '%s'", p, "x")
+	}
+
+	_, err = c.ExpectLengthPrefixed(9, true)
+	if err == nil {
+		t.Errorf("Expected an error for an invalid length field size")
+	}
+
+	// A huge length fails without waiting for, or allocating, its payload.
+	_, err = c.Tty().Write([]byte{0x7f, 0xff, 0xff, 0xff})
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	start := time.Now()
+	_, err = c.ExpectLengthPrefixed(4, true, WithTimeout(5*time.Second))
+	if !errors.Is(err, ErrFrameTooLarge) {
+		t.Errorf("Expected error '%s' but got '%v' instead", ErrFrameTooLarge, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the frame to be rejected quickly but took %s", elapsed)
+	}
+
+	_, err = c.Tty().Write([]byte{0x00, 0x04, 'a', 'b', 'c', 'd'})
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	_, err = c.ExpectLengthPrefixed(2, true, WithMaxFrameSize(3))
+	if !errors.Is(err, ErrFrameTooLarge) {
+		t.Errorf("Expected error '%s' but got '%v' instead", ErrFrameTooLarge, err)
+	}
+}
+
+func TestExpectBinary(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	defer testCloser(t, c)
+
+	// The tty translates newlines on output, so the needle avoids them.
+	needle := make([]byte, 1024)
+	for i := range needle {
+		needle[i] = byte(i*7+0x80) % 0xff
+		if needle[i] == '\n' {
+			needle[i] = 0xff
+		}
+	}
+
+	go func() {
+		c.Tty().WriteString("noise \xff\xfe noise ")
+		c.Tty().Write(needle)
+		c.Tty().WriteString(" trailing")
+	}()
+
+	_, err = c.Expect(Binary(needle))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+
+	out, err := c.ExpectString("trailing")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if out != " trailing" {
+		t.Errorf("Expected '%s' to equal '%s'", out, " trailing")
+	}
+}
+
+// countEngine is a MatchEngine that matches once n bytes have been fed.
+type countEngine struct {
+	n int
+}
+
+func (ce *countEngine) Feed(p []byte) bool {
+	ce.n -= len(p)
+	return ce.n <= 0
+}
+
+func TestExpectWithMatchEngine(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	defer testCloser(t, c)
+
+	go c.Tty().WriteString("header\xff\xfebody trailing")
+
+	out, err := c.Expect(WithMatchEngine(&countEngine{n: 12}))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	// Invalid UTF-8 is decoded as the replacement character.
+	if out != "header\ufffd\ufffdbody" {
+		t.Errorf("Expected '%q' to equal '%q'", out, "header\ufffd\ufffdbody")
+	}
+
+	out, err = c.ExpectString("trailing")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if out != " trailing" {
+		t.Errorf("Expected '%s' to equal '%s'", out, " trailing")
+	}
+}
+
+func TestExpectBlock(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	defer testCloser(t, c)
+
+	_, err = c.Tty().WriteString("header BEGIN line1 line2 END footer")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+
+	block, err := c.ExpectBlock("BEGIN", "END")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if block != " line1 line2 " {
+		t.Errorf("Expected '%s' to equal '%s'", block, " line1 line2 ")
+	}
+
+	out, err := c.ExpectString("footer")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if out != " footer" {
+		t.Errorf("Expected '%s' to equal '%s'", out, " footer")
+	}
+}
+
+func TestExpectBlockErrors(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewTestConsole(t, WithDefaultTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	defer testCloser(t, c)
+
+	_, err = c.Tty().WriteString("BEGIN outer BEGIN inner END")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	_, err = c.ExpectBlock("BEGIN", "END")
+	if !errors.Is(err, ErrNestedBlock) {
+		t.Errorf("Expected error '%s' but got '%v' instead", ErrNestedBlock, err)
+	}
+
+	_, err = c.Tty().WriteString("BEGIN unterminated")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	_, err = c.ExpectBlock("BEGIN", "END")
+	if err == nil || !strings.Contains(err.Error(), `block end "END"`) || !strings.Contains(err.Error(), "i/o timeout") {
+		t.Errorf("Expected a timeout expecting the block end but got '%v' instead", err)
+	}
+
+	_, err = c.Tty().WriteString("no block here")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	_, err = c.ExpectBlock("BEGIN", "END", String("here"))
+	if !errors.Is(err, ErrMarkerNotFound) || !strings.Contains(err.Error(), `block start "BEGIN"`) {
+		t.Errorf("Expected error '%s' but got '%v' instead", ErrMarkerNotFound, err)
+	}
+}
+
+func TestExpectBytes(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	defer testCloser(t, c)
+
+	needle := []byte("id=\xff\x00\xfe;")
+	_, err = c.Tty().Write(append([]byte("header "), needle...))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+
+	// Invalid UTF-8 is decoded to the replacement character, so String never
+	// sees the needle.
+	_, matcher, err := c.expect(context.Background(), String(string(needle)), Bytes(needle), WithTimeout(time.Second))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if _, ok := matcher.(*bytesMatcher); !ok {
+		t.Errorf("Expected Bytes to match but got %v", matcher)
+	}
+
+	_, err = c.Tty().Write(needle)
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	_, err = c.Expect(String(string(needle)), WithTimeout(100*time.Millisecond))
+	if !os.IsTimeout(err) {
+		t.Errorf("Expected error to be a timeout but got '%v' instead", err)
+	}
+}
+
+func TestExpectPrefix(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewTestConsole(t, WithDefaultTimeout(time.Second))
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	defer testCloser(t, c)
+
+	_, err = c.Tty().WriteString("SSH-2.0-OpenSSH\n")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	out, err := c.Expect(Prefix("SSH-2.0-"))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if out != "SSH-2.0-" {
+		t.Errorf("Expected '%s' to equal '%s'", out, "SSH-2.0-")
+	}
+	c.ExpectString("\n")
+
+	_, err = c.Tty().WriteString("garbage SSH-2.0-OpenSSH\n")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	out, err = c.Expect(Prefix("SSH-2.0-"))
+	if !errors.Is(err, ErrPrefixMismatch) {
+		t.Errorf("Expected error '%s' but got '%v' instead", ErrPrefixMismatch, err)
+	}
+	if out != "g" {
+		t.Errorf("Expected Expect to fail on the first unexpected byte but read '%s'", out)
+	}
+}
+
+func TestExpectWithMaxLines(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewTestConsole(t, WithDefaultTimeout(time.Second))
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	defer testCloser(t, c)
+
+	_, err = c.Tty().WriteString("booting\nready\n")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	out, err := c.Expect(String("ready"), WithMaxLines(2))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if out != "booting\r\nready" {
+		t.Errorf("Expected %q to equal %q", out, "booting\r\nready")
+	}
+	c.ExpectString("\n")
+
+	var lines strings.Builder
+	for i := 0; i < 501; i++ {
+		fmt.Fprintf(&lines, "log line %d\n", i)
+	}
+	go c.Tty().WriteString(lines.String())
+
+	out, err = c.Expect(String("ready"), WithMaxLines(500))
+	if !errors.Is(err, ErrMaxLines) {
+		t.Errorf("Expected error '%s' but got '%v' instead", ErrMaxLines, err)
+	}
+	if !strings.HasSuffix(out, "log line 499\r\n") {
+		t.Errorf("Expected Expect to fail on the 500th line but read '%s'", out)
+	}
+}
+
+func TestExpectReader(t *testing.T) {
+	t.Parallel()
+
+	session := []byte("Login: alice\r\nPassword: \r\nWelcome alice\r\n$ ")
+
+	out, err := ExpectReader(bytes.NewReader(session), String("Welcome"))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if out != "Login: alice\r\nPassword: \r\nWelcome" {
+		t.Errorf("Expected '%s' to end with '%s'", out, "Welcome")
+	}
+
+	out, err = ExpectReader(bytes.NewReader(session), String("denied"), Prompt("$"))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if !strings.HasSuffix(out, "Welcome alice\r\n$") {
+		t.Errorf("Expected '%s' to end with the prompt", out)
+	}
+
+	_, err = ExpectReader(bytes.NewReader(session), String("denied"))
+	if err != io.EOF {
+		t.Errorf("Expected EOF but got '%v'", err)
+	}
+}
+
+func TestExpectForbid(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	defer testCloser(t, c)
+
+	_, err = c.Tty().WriteString("starting\nFATAL: disk full\n$ ")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+
+	_, err = c.Expect(String("$ "), Forbid(String("FATAL: disk full")))
+	var abortErr *AbortError
+	if !errors.As(err, &abortErr) {
+		t.Fatalf("Expected an *AbortError but got '%v'", err)
+	}
+	if abortErr.Matcher.Criteria() != "FATAL: disk full" {
+		t.Errorf("Expected the forbidden condition but got '%v'", abortErr.Matcher.Criteria())
+	}
+	if line := abortErr.Buffer[abortErr.Offset:]; line != "FATAL: disk full" {
+		t.Errorf("Expected '%s' to equal '%s'", line, "FATAL: disk full")
+	}
+}
+
+func TestExpectEarliest(t *testing.T) {
+	t.Parallel()
+
+	out, err := ExpectReader(strings.NewReader("ushers"), Earliest("hers", "she", "he"))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if out != "ushe" {
+		t.Errorf("Expected '%s' to equal '%s'", out, "ushe")
+	}
+
+	// A regexp that is met earlier in the stream wins.
+	out, err = ExpectReader(strings.NewReader("ushers"), Earliest("hers"), RegexpPattern("sh.r"))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if out != "usher" {
+		t.Errorf("Expected '%s' to equal '%s'", out, "usher")
+	}
+
+	// Conditions on the content read win ties with Earliest, wherever they are
+	// in opts.
+	c, err := newTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	defer testCloser(t, c)
+
+	_, err = c.Tty().WriteString("hello")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	match, err := c.ExpectMatch(Earliest("hello"), RegexpPattern("hello"))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if _, ok := match.Matched.(*regexpMatcher); !ok {
+		t.Errorf("Expected the regexp to win the tie but got %v", match.Matched.Criteria())
+	}
+}
+
+func TestExpectWithProgressLog(t *testing.T) {
+	t.Parallel()
+
+	logs := new(lockedBuffer)
+	c, err := newTestConsole(t, WithLogger(log.New(logs, "", 0)))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	defer testCloser(t, c)
+
+	go func() {
+		c.Tty().WriteString("loading")
+		time.Sleep(100 * time.Millisecond)
+		c.Tty().WriteString("done")
+	}()
+
+	_, err = c.Expect(String("done"), WithProgressLog(20*time.Millisecond))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if !strings.Contains(logs.String(), `read 7 bytes ending in "loading"`) {
+		t.Errorf("Expected a progress log but got %q", logs.String())
+	}
+}
+
+func TestSendFile(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "expect")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	defer os.RemoveAll(dir)
+	script := filepath.Join(dir, "answers.txt")
+	err = ioutil.WriteFile(script, []byte("2\r\nxilfteN\n"), 0644)
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+
+	c, err := newTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	defer testCloser(t, c)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := c.SendFile(script, 10*time.Millisecond, "?: ")
+		if err != nil {
+			t.Errorf("Expected no error but got '%s'", err)
+		}
+		c.ExpectEOF()
+	}()
+
+	err = prompt(c.Tty(), c.Tty())
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	testCloser(t, c.Tty())
+	wg.Wait()
+}
+
+func TestSendLineWaitEcho(t *testing.T) {
+	if _, err := exec.LookPath("cat"); err != nil {
+		t.Skip("cat not found in PATH")
+	}
+	t.Parallel()
+
+	s, err := Spawn("cat")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	defer s.Close()
+
+	err = s.SendLineWaitEcho("hello", time.Second)
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+
+	// What cat prints follows the echo.
+	out, err := s.Expect(String("hello\r\n"), WithTimeout(time.Second))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if out != "hello\r\n" {
+		t.Errorf("Expected %q to equal %q", out, "hello\r\n")
+	}
+}
+
+func TestSendLineWaitEchoDisabled(t *testing.T) {
+	if _, err := exec.LookPath("stty"); err != nil {
+		t.Skip("stty not found in PATH")
+	}
+	t.Parallel()
+
+	s, err := Spawn("sh", "-c", "stty -echo; echo ready; sleep 5")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	defer s.Cmd.Process.Kill()
+	defer s.Close()
+
+	_, err = s.Expect(String("ready"), WithTimeout(time.Second))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+
+	err = s.SendLineWaitEcho("secret", 100*time.Millisecond)
+	if !os.IsTimeout(errors.Unwrap(err)) {
+		t.Errorf("Expected a timeout error but got '%v'", err)
+	}
+}
+
+func TestExpectThenSend(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	defer testCloser(t, c)
+
+	// Output that follows the prompt is written before the answer is read.
+	answers := make(chan string, 1)
+	go func() {
+		c.Tty().WriteString("Continue? [y/n] (default n)\n")
+		line, _ := bufio.NewReader(c.Tty()).ReadString('\n')
+		answers <- line
+	}()
+
+	out, err := c.ExpectThenSend(String("[y/n]"), "y\n")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if out != "Continue? [y/n]" {
+		t.Errorf("Expected '%s' to equal '%s'", out, "Continue? [y/n]")
+	}
+	if answer := <-answers; answer != "y\n" {
+		t.Errorf("Expected %q to equal %q", answer, "y\n")
+	}
+
+	// The rest of the output is left to the next Expect.
+	out, err = c.ExpectString("(default n)")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if out != " (default n)" {
+		t.Errorf("Expected '%s' to equal '%s'", out, " (default n)")
+	}
+}
+
+func TestResync(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	defer testCloser(t, c)
+
+	// Garbage holds truncated runes and escape sequences.
+	_, err = c.Tty().WriteString("\xe2\x82\x1b[3\xff\x1b]0;garbage SYNC-4f2a after")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+
+	err = c.Resync("SYNC-4f2a", time.Second)
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+
+	out, err := c.Expect(String("after"), WithTimeout(time.Second))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if out != " after" {
+		t.Errorf("Expected '%s' to equal '%s'", out, " after")
+	}
+
+	err = c.Resync("SYNC-never", 10*time.Millisecond)
+	if !os.IsTimeout(errors.Unwrap(err)) {
+		t.Errorf("Expected a timeout error but got '%v'", err)
+	}
+}
+
+func TestRunCommand(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	defer testCloser(t, c)
+
+	// A fake shell that prints the arguments of echo, relying on the tty to
+	// echo the commands.
+	go func() {
+		r := bufio.NewReader(c.Tty())
+		for {
+			_, err := c.Tty().WriteString("$ ")
+			if err != nil {
+				return
+			}
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			fmt.Fprintln(c.Tty(), strings.TrimPrefix(strings.TrimSpace(line), "echo "))
+		}
+	}()
+
+	// Commands are run once the shell prompts for the first one.
+	_, err = c.Expect(Prompt("$ "))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+
+	for _, word := range []string{"hello", "$world"} {
+		out, err := c.RunCommand("echo "+word, "$ ")
+		if err != nil {
+			t.Errorf("Expected no error but got '%s'", err)
+		}
+		if out != word+"\r\n" {
+			t.Errorf("Expected %q to equal %q", out, word+"\r\n")
+		}
+	}
+}
+
+func TestExpectOr(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	defer testCloser(t, c)
+
+	_, err = c.Tty().WriteString("$ ")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+
+	_, reason, err := c.ExpectOr(String("$ "))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if reason != MatchedPattern {
+		t.Errorf("Expected reason %d but got %d", MatchedPattern, reason)
+	}
+
+	// The program exits before printing the prompt.
+	_, err = c.Tty().WriteString("exiting\n")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	c.Tty().Close()
+
+	out, reason, err := c.ExpectOr(String("$ "))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if reason != MatchedEOF {
+		t.Errorf("Expected reason %d but got %d", MatchedEOF, reason)
+	}
+	if out != "exiting\r\n" {
+		t.Errorf("Expected %q to equal %q", out, "exiting\r\n")
+	}
+}
+
+func TestExpectValue(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	defer testCloser(t, c)
+
+	_, err = c.Tty().WriteString("Total: 42 items, 3 errors")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+
+	count := func(unit string) ExpectOpt {
+		return Map(RegexpPattern(`\d+ `+unit), func(match string) (interface{}, error) {
+			return strconv.Atoi(strings.TrimSuffix(match, " "+unit))
+		})
+	}
+
+	v, err := c.ExpectValue(count("items"))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if v != 42 {
+		t.Errorf("Expected %v to equal %v", v, 42)
+	}
+
+	errParse := errors.New("not a count")
+	_, err = c.ExpectValue(Map(String("errors"), func(match string) (interface{}, error) {
+		return nil, errParse
+	}))
+	var mapErr *MapError
+	if !errors.As(err, &mapErr) || !errors.Is(err, errParse) {
+		t.Fatalf("Expected a *MapError but got '%v'", err)
+	}
+	if mapErr.Match != "errors" {
+		t.Errorf("Expected '%s' to equal '%s'", mapErr.Match, "errors")
+	}
+}
+
+func TestExpectPrompt(t *testing.T) {
+	t.Parallel()
+
+	for _, p := range []string{"user@host:~$", "user@host:~$ "} {
+		c, err := newTestConsole(t)
+		if err != nil {
+			t.Errorf("Expected no error but got '%s'", err)
+		}
+		defer testCloser(t, c)
+
+		_, err = c.Tty().WriteString("Last login: today\n" + p)
+		if err != nil {
+			t.Errorf("Expected no error but got '%s'", err)
+		}
+
+		out, err := c.Expect(Prompt("$"))
+		if err != nil {
+			t.Errorf("Expected no error but got '%s'", err)
+		}
+		if !strings.HasSuffix(out, "user@host:~$") {
+			t.Errorf("Expected %q to end with the prompt", out)
+		}
+	}
+}
+
+func TestExpectContext(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	defer testCloser(t, c)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+
+	_, err = c.ExpectContext(ctx, String("never printed"))
+	if err != context.Canceled {
+		t.Errorf("Expected error '%s' but got '%s' instead", context.Canceled, err)
+	}
+
+	// The interrupted read does not affect the next Expect.
+	_, err = c.Tty().WriteString("Hello world")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	out, err := c.Expect(String("world"), WithTimeout(time.Second))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if out != "Hello world" {
+		t.Errorf("Expected '%s' to equal '%s'", out, "Hello world")
+	}
+}
+
+func TestExpectEOFContext(t *testing.T) {
+	t.Parallel()
+
+	stdout := new(lockedBuffer)
+	c, err := NewTestConsole(t, WithStdout(stdout))
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	defer testCloser(t, c)
+
+	// The program keeps trickling output and never closes its tty.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(5 * time.Millisecond):
+				c.Tty().WriteString(".")
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	n, err := c.ExpectEOFContext(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected error '%s' but got '%s' instead", context.DeadlineExceeded, err)
+	}
+	out := stdout.String()
+	if n == 0 || n != int64(len(out)) || strings.Trim(out, ".") != "" {
+		t.Errorf("Expected %d to be the number of bytes read so far, %q", n, out)
+	}
+}
+
+func TestExpectTitle(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	defer testCloser(t, c)
+
+	go c.Tty().WriteString("loading\x1b]0;editor - draft.txt\x1b\\ready")
+
+	title, err := c.ExpectTitle()
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if title != "editor - draft.txt" {
+		t.Errorf("Expected '%s' to equal '%s'", title, "editor - draft.txt")
+	}
+
+	out, err := c.ExpectString("ready")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if out != "ready" {
+		t.Errorf("Expected '%s' to equal '%s'", out, "ready")
+	}
+}
+
+func TestExpectFrame(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	defer testCloser(t, c)
+
+	go func() {
+		c.Tty().WriteString("first ")
+		c.Tty().WriteString("frame")
+		time.Sleep(200 * time.Millisecond)
+		c.Tty().WriteString("second frame")
+	}()
+
+	out, err := c.ExpectFrame(50 * time.Millisecond)
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if out != "first frame" {
+		t.Errorf("Expected '%s' to equal '%s'", out, "first frame")
+	}
+
+	out, err = c.ExpectFrame(50 * time.Millisecond)
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if out != "second frame" {
+		t.Errorf("Expected '%s' to equal '%s'", out, "second frame")
+	}
+}
+
+func TestExpectFrameNeverIdle(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	defer testCloser(t, c)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(5 * time.Millisecond):
+				c.Tty().WriteString(".")
+			}
+		}
+	}()
+
+	out, err := c.ExpectFrame(100*time.Millisecond, WithTimeout(200*time.Millisecond))
+	if !os.IsTimeout(err) {
+		t.Errorf("Expected a timeout error but got '%v'", err)
+	}
+	if out == "" {
+		t.Errorf("Expected the content read so far")
+	}
+}
+
+func TestExpectProcessExit(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found in PATH")
+	}
+	t.Parallel()
+
+	s, err := Spawn("sh", "-c", "echo exiting; exit 3")
+	if err != nil {
+		t.Fatalf("Expected no error but got '%s'", err)
+	}
+
+	_, reason, err := s.ExpectReason(String("never printed"), ProcessExit(s.Cmd), WithTimeout(5*time.Second))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if reason != MatchedProcessExit {
+		t.Errorf("Expected reason %d but got %d", MatchedProcessExit, reason)
+	}
+	if code := s.Cmd.ProcessState.ExitCode(); code != 3 {
+		t.Errorf("Expected exit code 3 but got %d", code)
+	}
+
+	// The exit is only signaled once, but remains matched.
+	_, reason, err = s.ExpectReason(ProcessExit(s.Cmd), WithTimeout(time.Second))
+	if err != nil || reason != MatchedProcessExit {
+		t.Errorf("Expected process exit but got %d, '%v'", reason, err)
+	}
+
+	var exitErr *exec.ExitError
+	err = s.Wait()
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Errorf("Expected exit status 3 but got '%v'", err)
+	}
+}
+
+func TestExpectDefaultTimeoutOverride(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t, WithDefaultTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	defer testCloser(t, c)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err = prompt(c.Tty(), c.Tty())
+		if err != nil {
+			t.Errorf("Expected no error but got '%s'", err)
+		}
+		time.Sleep(200 * time.Millisecond)
+		c.Tty().Close()
+	}()
+
+	c.ExpectString("What is 1+1?")
+	c.SendLine("2")
+	c.ExpectString("What is Netflix backwards?")
+	c.SendLine("xilfteN")
+	c.Expect(EOF, PTSClosed, WithTimeout(time.Second))
+
+	wg.Wait()
+}
+
+func TestExpectCount(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	defer testCloser(t, c)
+
+	_, err = c.Tty().WriteString(".......")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+
+	out, err := c.Expect(Count(5, String(".")), WithTimeout(time.Second))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if out != "....." {
+		t.Errorf("Expected '%s' to equal '%s'", out, ".....")
+	}
+
+	// The remaining occurrences are left for the next Expect.
+	out, err = c.Expect(Count(2, String(".")), WithTimeout(time.Second))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if out != ".." {
+		t.Errorf("Expected '%s' to equal '%s'", out, "..")
+	}
+}
+
+func TestExpectCROverwrite(t *testing.T) {
+	t.Parallel()
+
+	stdout := new(bytes.Buffer)
+	c, err := newTestConsole(t, WithCROverwrite(), WithStdout(stdout))
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	defer testCloser(t, c)
+
+	_, err = c.Tty().WriteString("\r10%\r50%\r100%")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+
+	out, _ := c.ExpectString("100%")
+	if strings.Contains(out, "50%") {
+		t.Errorf("Expected '%s' to not contain '%s'", out, "50%")
+	}
+	if out != "100%" {
+		t.Errorf("Expected '%s' to equal '%s'", out, "100%")
+	}
+
+	// Raw bytes are still written to stdout.
+	if stdout.String() != "\r10%\r50%\r100%" {
+		t.Errorf("Expected '%q' to equal '%q'", stdout.String(), "\r10%\r50%\r100%")
 	}
-	testCloser(t, c.Tty())
-	wg.Wait()
 }
 
-func TestExpectDefaultTimeout(t *testing.T) {
+func TestExpectScreen(t *testing.T) {
 	t.Parallel()
 
-	c, err := NewTestConsole(t, WithDefaultTimeout(0))
+	c, err := newTestConsole(t, WithScreen(3, 20))
 	if err != nil {
 		t.Errorf("Expected no error but got'%s'", err)
 	}
 	defer testCloser(t, c)
 
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		Prompt(c.Tty(), c.Tty())
-	}()
+	_, err = c.Tty().WriteString("Loading...\x1b[2J\x1b[2;5HName: \x1b[1;1HForm\x1b[3;5HDone")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
 
-	_, err = c.ExpectString("What is 1+2?")
-	if err == nil || !strings.Contains(err.Error(), "i/o timeout") {
-		t.Errorf("Expected error to contain 'i/o timeout' but got '%s' instead", err)
+	out, _ := c.ExpectScreen(String("Done"))
+	expected := "Form\n    Name:\n    Done"
+	if out != expected {
+		t.Errorf("Expected '%q' to equal '%q'", out, expected)
+	}
+	if c.Screen() != expected {
+		t.Errorf("Expected '%q' to equal '%q'", c.Screen(), expected)
 	}
 
-	// Close to unblock Prompt and wait for the goroutine to exit.
-	c.Tty().Close()
-	wg.Wait()
+	// Content already on screen matches without reading.
+	out, _ = c.ExpectScreen(String("Name:"))
+	if out != expected {
+		t.Errorf("Expected '%q' to equal '%q'", out, expected)
+	}
 }
 
-func TestExpectTimeout(t *testing.T) {
+func TestExpectScreenCursorAt(t *testing.T) {
 	t.Parallel()
 
-	c, err := NewTestConsole(t)
+	c, err := newTestConsole(t, WithScreen(3, 20))
 	if err != nil {
 		t.Errorf("Expected no error but got'%s'", err)
 	}
 	defer testCloser(t, c)
 
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		Prompt(c.Tty(), c.Tty())
-	}()
+	_, err = c.Tty().WriteString("\x1b[2;5HName:\x1b[1;1HForm\x1b[2;11H")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
 
-	_, err = c.Expect(String("What is 1+2?"), WithTimeout(0))
-	if err == nil || !strings.Contains(err.Error(), "i/o timeout") {
-		t.Errorf("Expected error to contain 'i/o timeout' but got '%s' instead", err)
+	out, err := c.ExpectScreen(CursorAt(1, 10))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	expected := "Form\n    Name:\n"
+	if out != expected {
+		t.Errorf("Expected '%q' to equal '%q'", out, expected)
 	}
 
-	// Close to unblock Prompt and wait for the goroutine to exit.
-	c.Tty().Close()
-	wg.Wait()
+	// The cursor is already in place, so it matches without reading.
+	_, err = c.ExpectScreen(CursorAt(1, 10))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
 }
 
-func TestExpectDefaultTimeoutOverride(t *testing.T) {
+func TestExpectScreenWithoutScreen(t *testing.T) {
 	t.Parallel()
 
-	c, err := newTestConsole(t, WithDefaultTimeout(100*time.Millisecond))
+	c, err := NewConsole()
 	if err != nil {
 		t.Errorf("Expected no error but got'%s'", err)
 	}
 	defer testCloser(t, c)
 
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		err = Prompt(c.Tty(), c.Tty())
+	_, err = c.ExpectScreen(String("Done"))
+	if err != ErrNoScreen {
+		t.Errorf("Expected error '%s' but got '%s' instead", ErrNoScreen, err)
+	}
+}
+
+// flakyReader returns each of errs once before reading from reader.
+type flakyReader struct {
+	errs   []error
+	reader io.Reader
+}
+
+func (fr *flakyReader) Read(p []byte) (int, error) {
+	if len(fr.errs) > 0 {
+		err := fr.errs[0]
+		fr.errs = fr.errs[1:]
+		return 0, err
+	}
+	return fr.reader.Read(p)
+}
+
+// errReader is an io.Reader that always fails.
+type errReader struct {
+	err error
+}
+
+func (er errReader) Read(p []byte) (int, error) {
+	return 0, er.err
+}
+
+func TestExpectContentOnError(t *testing.T) {
+	t.Parallel()
+
+	errTest := errors.New("test error")
+
+	t.Run("Read", func(t *testing.T) {
+		r := io.MultiReader(strings.NewReader("Hello"), errReader{errTest})
+		out, err := ExpectReader(r, String("world"))
+		if err != errTest {
+			t.Errorf("Expected '%v' but got '%v'", errTest, err)
+		}
+		if out != "Hello" {
+			t.Errorf("Expected '%s' to equal '%s'", out, "Hello")
+		}
+	})
+
+	t.Run("Write", func(t *testing.T) {
+		c, err := NewTestConsole(t, WithStdout(errWriter{errTest}))
 		if err != nil {
 			t.Errorf("Expected no error but got '%s'", err)
 		}
-		time.Sleep(200 * time.Millisecond)
-		c.Tty().Close()
-	}()
+		defer testCloser(t, c)
 
-	c.ExpectString("What is 1+1?")
-	c.SendLine("2")
-	c.ExpectString("What is Netflix backwards?")
-	c.SendLine("xilfteN")
-	c.Expect(EOF, PTSClosed, WithTimeout(time.Second))
+		_, err = c.Tty().WriteString("Hello world")
+		if err != nil {
+			t.Errorf("Expected no error but got '%s'", err)
+		}
+		out, err := c.ExpectString("world")
+		if err != errTest {
+			t.Errorf("Expected '%v' but got '%v'", errTest, err)
+		}
+		if out != "H" {
+			t.Errorf("Expected '%s' to equal '%s'", out, "H")
+		}
+	})
 
-	wg.Wait()
+	t.Run("Callback", func(t *testing.T) {
+		out, err := ExpectReader(strings.NewReader("Hello world"), String("Hello").Then(func(buf *bytes.Buffer) error {
+			return errTest
+		}))
+		if err != errTest {
+			t.Errorf("Expected '%v' but got '%v'", errTest, err)
+		}
+		if out != "Hello" {
+			t.Errorf("Expected '%s' to equal '%s'", out, "Hello")
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		c, err := NewTestConsole(t)
+		if err != nil {
+			t.Errorf("Expected no error but got '%s'", err)
+		}
+		defer testCloser(t, c)
+
+		_, err = c.Tty().WriteString("Hello")
+		if err != nil {
+			t.Errorf("Expected no error but got '%s'", err)
+		}
+		out, err := c.Expect(String("world"), WithTimeout(50*time.Millisecond))
+		if !os.IsTimeout(err) {
+			t.Errorf("Expected a timeout but got '%v'", err)
+		}
+		if out != "Hello" {
+			t.Errorf("Expected '%s' to equal '%s'", out, "Hello")
+		}
+	})
+}
+
+func TestExpectRetriesInterruptedReads(t *testing.T) {
+	t.Parallel()
+
+	reader := &flakyReader{
+		errs: []error{
+			&os.PathError{Op: "read", Path: "/dev/ptmx", Err: syscall.EINTR},
+			&os.PathError{Op: "read", Path: "/dev/ptmx", Err: syscall.EAGAIN},
+			syscall.EINTR,
+		},
+		reader: strings.NewReader("Hello world"),
+	}
+	opts := ConsoleOpts{Logger: log.New(ioutil.Discard, "", 0)}
+	c := &Console{
+		ctx:        context.Background(),
+		opts:       opts,
+		stdout:     newStdoutWriter(opts),
+		stats:      new(stats),
+		runeReader: bufio.NewReaderSize(reader, utf8.UTFMax),
+	}
+
+	out, err := c.ExpectString("world")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if out != "Hello world" {
+		t.Errorf("Expected '%s' to equal '%s'", out, "Hello world")
+	}
 }
 
 func TestConsoleChain(t *testing.T) {
@@ -312,7 +1994,7 @@ func TestConsoleChain(t *testing.T) {
 		c2.ExpectEOF()
 	}()
 
-	err = Prompt(c2.Tty(), c2.Tty())
+	err = prompt(c2.Tty(), c2.Tty())
 	if err != nil {
 		t.Errorf("Expected no error but got '%s'", err)
 	}
@@ -401,3 +2083,253 @@ func ExampleConsole_echo() {
 
 	// Output: Hello world
 }
+
+func TestExpectShellExit(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	defer testCloser(t, c)
+
+	_, err = c.Tty().WriteString("exit\nConnection closed by foreign host.\n")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+
+	out, reason, err := c.ExpectReason(ShellExit("$ "))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if reason != MatchedPattern {
+		t.Errorf("Expected reason %v but got %v", MatchedPattern, reason)
+	}
+	if out != "exit\r\nConnection closed" {
+		t.Errorf("Expected %q to equal %q", out, "exit\r\nConnection closed")
+	}
+
+	c.Tty().Close()
+	_, reason, err = c.ExpectReason(ShellExit("$ "))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if reason != MatchedEOF {
+		t.Errorf("Expected reason %v but got %v", MatchedEOF, reason)
+	}
+}
+
+func TestExpectLine(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	defer testCloser(t, c)
+
+	_, err = c.Tty().WriteString("first line\nsecond")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+
+	line, err := c.ExpectLine()
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if line != "first line" {
+		t.Errorf("Expected %q to equal %q", line, "first line")
+	}
+
+	// Another condition returns the content read as is.
+	c.Tty().Close()
+	line, err = c.ExpectLine(EOF, PTSClosed)
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if line != "second" {
+		t.Errorf("Expected %q to equal %q", line, "second")
+	}
+}
+
+func TestExpectJSON(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	defer testCloser(t, c)
+
+	_, err = c.Tty().WriteString(`{"name":"web","replicas":3,"ready":true}` + "\n" + `{"name":` + "\n")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+
+	var status struct {
+		Name     string `json:"name"`
+		Replicas int    `json:"replicas"`
+		Ready    bool   `json:"ready"`
+	}
+	err = c.ExpectJSON(&status, WithTimeout(time.Second))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if status.Name != "web" || status.Replicas != 3 || !status.Ready {
+		t.Errorf("Unexpected status %+v", status)
+	}
+
+	err = c.ExpectJSON(&status, WithTimeout(time.Second))
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Errorf("Expected a JSON syntax error but got '%v'", err)
+	}
+}
+
+func TestExpectToken(t *testing.T) {
+	t.Parallel()
+
+	// The last token is read at EOF, which the observers see as an error.
+	c, err := NewTestConsole(t, WithDefaultTimeout(time.Second))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	defer testCloser(t, c)
+
+	_, err = c.Tty().WriteString("status: starting ready serving\n")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+
+	isWord := func(word string) func([]byte) bool {
+		return func(token []byte) bool {
+			return string(token) == word
+		}
+	}
+	token, err := c.ExpectToken(bufio.ScanWords, isWord("ready"))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if string(token) != "ready" {
+		t.Errorf("Expected %q to equal %q", token, "ready")
+	}
+
+	_, err = c.Tty().WriteString("done")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	c.Tty().Close()
+	token, err = c.ExpectToken(bufio.ScanWords, isWord("done"))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if string(token) != "done" {
+		t.Errorf("Expected %q to equal %q", token, "done")
+	}
+}
+
+func TestWithErrorContextBytes(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewTestConsole(t, WithErrorContextBytes(16))
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	defer testCloser(t, c)
+
+	data := strings.Repeat("noise ", 500) + "last words"
+	go c.Tty().WriteString(data)
+
+	out, err := c.Expect(String("never printed"), WithTimeout(time.Second))
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("Expected a *TimeoutError but got '%v'", err)
+	}
+	if !errors.Is(err, ErrTimeout) || !os.IsTimeout(err) {
+		t.Errorf("Expected '%v' to be a timeout", err)
+	}
+
+	expected := `i/o timeout after reading "...noise last words"`
+	if err.Error() != expected {
+		t.Errorf("Expected '%s' to equal '%s'", err.Error(), expected)
+	}
+	if timeoutErr.Buffer != data || out != data {
+		t.Errorf("Expected the full content in the error, got %d bytes", len(timeoutErr.Buffer))
+	}
+}
+
+func TestWithErrorContextBytesDefault(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewTestConsole(t, WithDefaultTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	defer testCloser(t, c)
+
+	_, err = c.Tty().WriteString("all of the output")
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	_, err = c.ExpectString("never printed")
+	expected := `i/o timeout after reading "all of the output"`
+	if err == nil || err.Error() != expected {
+		t.Errorf("Expected '%v' to equal '%s'", err, expected)
+	}
+
+	for _, n := range []int{0, -1} {
+		_, err = NewConsole(WithErrorContextBytes(n))
+		if err == nil {
+			t.Errorf("Expected an error for %d error context bytes", n)
+		}
+	}
+}
+
+func TestTimeoutErrorReceivedAnyBytes(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		title    string
+		input    string
+		literal  bool
+		expected bool
+	}{
+		{"Silent", "", false, false},
+		{"Mismatch", "hello", false, true},
+		{"Literal silent", "", true, false},
+		{"Literal mismatch", "hello", true, true},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.title, func(t *testing.T) {
+			t.Parallel()
+
+			c, err := NewTestConsole(t, WithDefaultTimeout(100*time.Millisecond))
+			if err != nil {
+				t.Errorf("Expected no error but got '%s'", err)
+			}
+			defer testCloser(t, c)
+
+			if test.input != "" {
+				_, err = c.Tty().WriteString(test.input)
+				if err != nil {
+					t.Errorf("Expected no error but got '%s'", err)
+				}
+			}
+
+			if test.literal {
+				_, err = c.ExpectString("$ ")
+			} else {
+				_, err = c.Expect(String("$ "))
+			}
+			var timeoutErr *TimeoutError
+			if !errors.As(err, &timeoutErr) {
+				t.Fatalf("Expected a *TimeoutError but got '%v'", err)
+			}
+			if timeoutErr.ReceivedAnyBytes != test.expected {
+				t.Errorf("Expected ReceivedAnyBytes to be %v", test.expected)
+			}
+		})
+	}
+}
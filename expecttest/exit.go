@@ -0,0 +1,56 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expecttest
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+
+	expect "github.com/Netflix/go-expect"
+)
+
+// AssertExitSignal waits for cmd, started on c's tty, to exit while draining
+// its output until EOF, like Session.Wait, and fails the test unless it was
+// terminated by sig, e.g. rather than exiting by itself or crashing. c is
+// closed afterwards.
+func AssertExitSignal(t TestingT, c *expect.Console, cmd *exec.Cmd, sig syscall.Signal) {
+	t.Helper()
+
+	s := &expect.Session{Console: c, Cmd: cmd}
+	err := s.Wait()
+	if err == nil {
+		t.Fatalf("Expected %s to be terminated by %s but it exited successfully", cmd.Path, sig)
+		return
+	}
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("Failed to wait for %s: %s", cmd.Path, err)
+		return
+	}
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok {
+		t.Fatalf("Failed to get the wait status of %s: %s", cmd.Path, err)
+		return
+	}
+	if !status.Signaled() {
+		t.Fatalf("Expected %s to be terminated by %s but it exited with status %d", cmd.Path, sig, status.ExitStatus())
+		return
+	}
+	if status.Signal() != sig {
+		t.Fatalf("Expected %s to be terminated by %s but it was terminated by %s", cmd.Path, sig, status.Signal())
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package expecttest
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssertExitSignal(t *testing.T) {
+	t.Parallel()
+
+	c := newConsole(t)
+	cmd := c.Command("sleep", "10")
+	require.NoError(t, cmd.Start())
+	require.NoError(t, cmd.Process.Signal(syscall.SIGINT))
+
+	ft := new(fakeT)
+	AssertExitSignal(ft, c, cmd, syscall.SIGINT)
+	require.Empty(t, ft.failures)
+}
+
+func TestAssertExitSignalFailure(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		title    string
+		args     []string
+		expected string
+	}{
+		{
+			"Exited successfully",
+			[]string{"-c", "exit 0"},
+			"but it exited successfully",
+		},
+		{
+			"Exited with status",
+			[]string{"-c", "exit 3"},
+			"but it exited with status 3",
+		},
+		{
+			"Other signal",
+			[]string{"-c", "kill -TERM $$"},
+			"but it was terminated by terminated",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.title, func(t *testing.T) {
+			t.Parallel()
+
+			c := newConsole(t)
+			cmd := c.Command("sh", test.args...)
+			require.NoError(t, cmd.Start())
+
+			ft := new(fakeT)
+			AssertExitSignal(ft, c, cmd, syscall.SIGINT)
+			require.Len(t, ft.failures, 1)
+			require.Contains(t, ft.failures[0], test.expected)
+		})
+	}
+}
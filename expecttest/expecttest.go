@@ -0,0 +1,95 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package expecttest provides test helpers that wrap Console operations and
+// fail the test with a descriptive message when they return an error, in the
+// style of testify's require package.
+package expecttest
+
+import (
+	"fmt"
+	"strings"
+
+	expect "github.com/Netflix/go-expect"
+)
+
+// TestingT is the subset of testing.TB used by the helpers.
+type TestingT interface {
+	Helper()
+	Fatalf(format string, args ...interface{})
+}
+
+// Expect calls c.Expect with opts and returns the buffer read, failing the
+// test with the conditions and the buffer if an error occurs.
+func Expect(t TestingT, c *expect.Console, opts ...expect.ExpectOpt) string {
+	t.Helper()
+
+	buf, err := c.Expect(opts...)
+	if err != nil {
+		t.Fatalf("Failed to find [%s] in %q: %s", criteria(opts), buf, err)
+	}
+	return buf
+}
+
+// ExpectString calls c.ExpectString with s and returns the buffer read,
+// failing the test with the buffer if an error occurs.
+func ExpectString(t TestingT, c *expect.Console, s string) string {
+	t.Helper()
+	return Expect(t, c, expect.String(s))
+}
+
+// ExpectEOF calls c.ExpectEOF and returns the buffer read, failing the test
+// with the buffer if an error occurs.
+func ExpectEOF(t TestingT, c *expect.Console) string {
+	t.Helper()
+	return Expect(t, c, expect.EOF, expect.PTSClosed)
+}
+
+// Send calls c.Send with s, failing the test if an error occurs or s was only
+// partially sent.
+func Send(t TestingT, c *expect.Console, s string) {
+	t.Helper()
+
+	n, err := c.Send(s)
+	if err != nil {
+		t.Fatalf("Failed to send %q: %s", s, err)
+		return
+	}
+	if n != len(s) {
+		t.Fatalf("Only sent %d of %d bytes for %q", n, len(s), s)
+	}
+}
+
+// SendLine calls c.SendLine with s, failing the test if an error occurs or s
+// was only partially sent.
+func SendLine(t TestingT, c *expect.Console, s string) {
+	t.Helper()
+	Send(t, c, s+"\n")
+}
+
+// criteria describes the conditions of opts.
+func criteria(opts []expect.ExpectOpt) string {
+	var options expect.ExpectOpts
+	for _, opt := range opts {
+		if err := opt(&options); err != nil {
+			return err.Error()
+		}
+	}
+
+	var criteria []string
+	for _, matcher := range options.Matchers {
+		criteria = append(criteria, fmt.Sprintf("%q", matcher.Criteria()))
+	}
+	return strings.Join(criteria, ", ")
+}
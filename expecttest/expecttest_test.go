@@ -0,0 +1,85 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expecttest
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	expect "github.com/Netflix/go-expect"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeT records the failures of the helpers.
+type fakeT struct {
+	failures []string
+}
+
+func (ft *fakeT) Helper() {}
+
+func (ft *fakeT) Fatalf(format string, args ...interface{}) {
+	ft.failures = append(ft.failures, fmt.Sprintf(format, args...))
+}
+
+func newConsole(t *testing.T) *expect.Console {
+	c, err := expect.NewConsole(expect.WithDefaultTimeout(100 * time.Millisecond))
+	require.NoError(t, err)
+	return c
+}
+
+func TestExpectString(t *testing.T) {
+	t.Parallel()
+
+	c := newConsole(t)
+	defer c.Close()
+
+	ft := new(fakeT)
+	_, err := c.Tty().WriteString("What is 1+1?")
+	require.NoError(t, err)
+
+	out := ExpectString(ft, c, "1+1?")
+	require.Equal(t, "What is 1+1?", out)
+	SendLine(ft, c, "2")
+	require.Empty(t, ft.failures)
+}
+
+func TestExpectFailure(t *testing.T) {
+	t.Parallel()
+
+	c := newConsole(t)
+	defer c.Close()
+
+	ft := new(fakeT)
+	_, err := c.Tty().WriteString("What is 1+1?")
+	require.NoError(t, err)
+
+	Expect(ft, c, expect.String("1+2?", "Netflix"))
+	require.Equal(t, []string{
+		`Failed to find ["1+2?", "Netflix"] in "What is 1+1?": i/o timeout after reading "What is 1+1?"`,
+	}, ft.failures)
+}
+
+func TestSendFailure(t *testing.T) {
+	t.Parallel()
+
+	c := newConsole(t)
+	c.Close()
+
+	ft := new(fakeT)
+	SendLine(ft, c, "2")
+	require.Len(t, ft.failures, 1)
+	require.Contains(t, ft.failures[0], `Failed to send "2\n": `)
+}
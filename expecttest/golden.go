@@ -0,0 +1,103 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expecttest
+
+import (
+	"bytes"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	expect "github.com/Netflix/go-expect"
+)
+
+// ansiSequence matches ANSI escape sequences: CSI sequences such as colors and
+// cursor movements, OSC sequences such as titles, and two-byte escapes.
+var ansiSequence = regexp.MustCompile(`\x1b(?:\[[0-?]*[ -/]*[@-~]|\][^\x07\x1b]*(?:\x07|\x1b\\)|[@-Z\\-_])`)
+
+// GoldenOpt allows setting how AssertGolden normalizes output.
+type GoldenOpt func(*GoldenOpts)
+
+// GoldenOpts provides settings for AssertGolden.
+type GoldenOpts struct {
+	// KeepANSI keeps ANSI escape sequences in the output, which are stripped
+	// by default so that golden files don't depend on colors or cursor
+	// movements.
+	KeepANSI bool
+
+	// Update writes the output to the golden file instead of comparing it.
+	Update bool
+}
+
+// WithANSI keeps ANSI escape sequences in the output compared to the golden
+// file.
+func WithANSI() GoldenOpt {
+	return func(opts *GoldenOpts) {
+		opts.KeepANSI = true
+	}
+}
+
+// WithUpdate writes the output to the golden file instead of comparing it when
+// update is true, e.g. with the value of a test package's own -update flag:
+//
+//	var update = flag.Bool("update", false, "update golden files")
+//
+//	expecttest.AssertGolden(t, c, "testdata/session.golden", expecttest.WithUpdate(*update))
+func WithUpdate(update bool) GoldenOpt {
+	return func(opts *GoldenOpts) {
+		opts.Update = update
+	}
+}
+
+// AssertGolden reads from c until EOF, like ExpectEOF, and fails the test if
+// the output differs from the content of the file at goldenPath. Line endings
+// are normalized to "\n" and ANSI escape sequences are stripped unless
+// WithANSI is set. With WithUpdate, the golden file is written with the output
+// instead.
+func AssertGolden(t TestingT, c *expect.Console, goldenPath string, opts ...GoldenOpt) {
+	t.Helper()
+
+	var options GoldenOpts
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	out := normalize(ExpectEOF(t, c), options)
+	if options.Update {
+		err := ioutil.WriteFile(goldenPath, []byte(out), 0644)
+		if err != nil {
+			t.Fatalf("Failed to update golden file: %s", err)
+		}
+		return
+	}
+
+	golden, err := ioutil.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatalf("Failed to read golden file, use WithUpdate to create it: %s", err)
+		return
+	}
+	if !bytes.Equal(golden, []byte(out)) {
+		t.Fatalf("Output does not match golden file %s:\ngot:  %q\nwant: %q", goldenPath, out, golden)
+	}
+}
+
+// normalize rewrites out as configured by options for comparison to a golden
+// file.
+func normalize(out string, options GoldenOpts) string {
+	if !options.KeepANSI {
+		out = ansiSequence.ReplaceAllString(out, "")
+	}
+	return strings.Replace(out, "\r\n", "\n", -1)
+}
@@ -0,0 +1,82 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expecttest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssertGolden(t *testing.T) {
+	dir, err := ioutil.TempDir("", "expecttest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	golden := filepath.Join(dir, "session.golden")
+
+	session := func(greeting string, opts ...GoldenOpt) {
+		c := newConsole(t)
+		defer c.Close()
+
+		_, err := c.Tty().WriteString("\x1b]0;title\x07\x1b[1;32m" + greeting + "\x1b[0m\nbye\n")
+		require.NoError(t, err)
+		require.NoError(t, c.Tty().Close())
+
+		ft := new(fakeT)
+		AssertGolden(ft, c, golden, opts...)
+		require.Empty(t, ft.failures)
+	}
+
+	// The golden file is generated with WithUpdate, and compared to afterwards.
+	session("hello", WithUpdate(true))
+
+	content, err := ioutil.ReadFile(golden)
+	require.NoError(t, err)
+	require.Equal(t, "hello\nbye\n", string(content))
+
+	session("hello", WithUpdate(false))
+
+	c := newConsole(t)
+	defer c.Close()
+	_, err = c.Tty().WriteString("goodbye\n")
+	require.NoError(t, err)
+	require.NoError(t, c.Tty().Close())
+
+	ft := new(fakeT)
+	AssertGolden(ft, c, golden)
+	require.Len(t, ft.failures, 1)
+	require.Contains(t, ft.failures[0], "Output does not match golden file")
+}
+
+func TestAssertGoldenWithANSI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "expecttest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	golden := filepath.Join(dir, "session.golden")
+	require.NoError(t, ioutil.WriteFile(golden, []byte("\x1b[1mbold\x1b[0m\n"), 0644))
+
+	c := newConsole(t)
+	defer c.Close()
+	_, err = c.Tty().WriteString("\x1b[1mbold\x1b[0m\n")
+	require.NoError(t, err)
+	require.NoError(t, c.Tty().Close())
+
+	ft := new(fakeT)
+	AssertGolden(ft, c, golden, WithANSI())
+	require.Empty(t, ft.failures)
+}
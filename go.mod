@@ -5,4 +5,5 @@ go 1.13
 require (
 	github.com/creack/pty v1.1.17
 	github.com/stretchr/testify v1.6.1
+	golang.org/x/text v0.3.8
 )
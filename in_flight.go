@@ -0,0 +1,88 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import "sync"
+
+// inFlightTail is how many runes at the end of the content read by an Expect
+// in progress are reported by InFlight.
+const inFlightTail = 256
+
+// inFlight records the Expect in progress on a Console for InFlight. It is
+// shared by a Console and its clones from With, which read from the same tty
+// and can't Expect concurrently.
+type inFlight struct {
+	mu       sync.Mutex
+	active   bool
+	matchers []Matcher
+	tail     []rune
+}
+
+// begin records the start of an Expect with matchers.
+func (f *inFlight) begin(matchers []Matcher) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.active = true
+	f.matchers = matchers
+	f.tail = f.tail[:0]
+}
+
+// received records rune r read by the Expect in progress.
+func (f *inFlight) received(r rune) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.tail = append(f.tail, r)
+	if len(f.tail) > inFlightTail {
+		f.tail = append(f.tail[:0], f.tail[len(f.tail)-inFlightTail:]...)
+	}
+}
+
+// end records that the Expect in progress returned.
+func (f *inFlight) end() {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.active = false
+	f.matchers = nil
+}
+
+// InFlight returns the conditions of the Expect in progress on Console or its
+// clones, and the end of the content it read so far, as read from the tty. If
+// no Expect is in progress, ok is false. It may be called from any goroutine,
+// e.g. from a signal handler that reports what a hung test is waiting for.
+func (c *Console) InFlight() (matchers []Matcher, bufferTail string, ok bool) {
+	f := c.inFlight
+	if f == nil {
+		return nil, "", false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.active {
+		return nil, "", false
+	}
+	return append([]Matcher(nil), f.matchers...), string(f.tail), true
+}
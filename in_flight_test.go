@@ -0,0 +1,69 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInFlight(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t)
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	_, _, ok := c.InFlight()
+	require.False(t, ok)
+
+	_, err = c.Tty().WriteString("Loading...")
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.With().Expect(String("ready"), WithTimeout(5*time.Second))
+	}()
+
+	// Wait for the Expect to block after reading what was written.
+	require.Eventually(t, func() bool {
+		_, tail, ok := c.InFlight()
+		return ok && tail == "Loading..."
+	}, time.Second, 5*time.Millisecond)
+
+	matchers, _, _ := c.InFlight()
+	require.Len(t, matchers, 1)
+	require.Equal(t, "ready", matchers[0].Criteria())
+
+	_, err = c.Tty().WriteString("ready")
+	require.NoError(t, err)
+	<-done
+
+	_, _, ok = c.InFlight()
+	require.False(t, ok)
+}
+
+func TestInFlightTail(t *testing.T) {
+	var f inFlight
+	f.begin(nil)
+	for i := 0; i < inFlightTail*2; i++ {
+		f.received(rune('a' + i%26))
+	}
+	require.Len(t, f.tail, inFlightTail)
+	require.Equal(t, rune('a'+(inFlightTail*2-1)%26), f.tail[len(f.tail)-1])
+}
@@ -0,0 +1,91 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"os"
+	"unicode/utf8"
+)
+
+// IncompleteRunePolicy is what Expect does with a UTF-8 sequence that is cut
+// short because reading Console's tty failed before it was complete, most
+// commonly when a program exits or closes the tty in the middle of a
+// multi-byte rune.
+type IncompleteRunePolicy int
+
+const (
+	// IncompleteRuneKeep adds the bytes of the incomplete sequence to the
+	// content read as is, and writes them to Console's stdouts, so a
+	// truncated tail isn't lost. Conditions see them as read, e.g. Bytes can
+	// match them. This is the default.
+	IncompleteRuneKeep IncompleteRunePolicy = iota
+
+	// IncompleteRuneReplace decodes each byte of the incomplete sequence to
+	// utf8.RuneError, like invalid UTF-8 in the rest of the output.
+	IncompleteRuneReplace
+)
+
+// WithIncompleteRunePolicy sets what Expect does with a UTF-8 sequence cut
+// short by EOF or another read error. By default its bytes are kept as read,
+// see IncompleteRuneKeep. Invalid UTF-8 that is followed by more output is
+// always decoded to utf8.RuneError.
+func WithIncompleteRunePolicy(policy IncompleteRunePolicy) ConsoleOpt {
+	return func(opts *ConsoleOpts) error {
+		opts.IncompleteRunePolicy = policy
+		return nil
+	}
+}
+
+// incompleteRune returns the bytes of the UTF-8 sequence that starts with
+// rune r of width size just read from Console's tty, if it couldn't be
+// completed, and consumes them. Otherwise, or if Console replaces incomplete
+// runes, it returns nil.
+//
+// The rune reader only stops filling its buffer before a sequence is complete
+// when a read fails. If the read timed out, e.g. at a deadline of Expect's own
+// such as WithProgressLog's, the rest of the rune may still arrive, so the
+// bytes are left buffered to be read again and the timeout is returned.
+// Otherwise the sequence was cut short by EOF or an error, which is returned by
+// the next read.
+func (c *Console) incompleteRune(r rune, size int) ([]byte, error) {
+	if r != utf8.RuneError || size != 1 {
+		return nil, nil
+	}
+	if err := c.runeReader.UnreadRune(); err != nil {
+		return nil, nil
+	}
+
+	p, err := c.runeReader.Peek(c.runeReader.Buffered())
+	if err != nil || utf8.FullRune(p) {
+		// The byte is invalid on its own, so it is read again as a rune, which
+		// also lets the caller unread it.
+		c.runeReader.ReadRune()
+		return nil, nil
+	}
+
+	// Peeking past the buffered bytes returns the error that stopped the rune
+	// reader without reading more.
+	_, err = c.runeReader.Peek(len(p) + 1)
+	if err != nil && os.IsTimeout(err) {
+		return nil, err
+	}
+	if c.opts.IncompleteRunePolicy != IncompleteRuneKeep {
+		c.runeReader.ReadRune()
+		return nil, nil
+	}
+	partial := append([]byte(nil), p...)
+	c.runeReader.Discard(len(partial))
+	return partial, nil
+}
@@ -0,0 +1,64 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"bytes"
+	"errors"
+	"time"
+)
+
+// ErrInputRequestUnsupported is returned by WaitForInputRequest on platforms
+// where it can't tell whether a program is reading its tty.
+var ErrInputRequestUnsupported = errors.New("input request detection is not supported on this platform")
+
+// inputRequestInterval is how often WaitForInputRequest checks whether a
+// program is reading Console's tty.
+const inputRequestInterval = 10 * time.Millisecond
+
+// WaitForInputRequest waits until a program is blocked reading from Console's
+// tty, so that input can be sent at the point the program asks for it rather
+// than being queued up early. If no program reads from the tty within timeout,
+// a timeout error is returned. A zero timeout waits indefinitely.
+//
+// Detection is best-effort and only supported on Linux, where it looks for a
+// thread in /proc that is blocked in a read or readv syscall on the tty, which
+// requires the permission to inspect the program, as for ptrace. Programs that
+// wait for input in poll, select or epoll before reading aren't detected until
+// they read. Elsewhere ErrInputRequestUnsupported is returned.
+func (c *Console) WaitForInputRequest(timeout time.Duration) error {
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+
+	ticker := time.NewTicker(inputRequestInterval)
+	defer ticker.Stop()
+	for {
+		requested, err := inputRequested(c.pts.Name())
+		if err != nil || requested {
+			return err
+		}
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return c.timeoutError(new(bytes.Buffer), 0)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-c.Done():
+			return ErrClosed
+		}
+	}
+}
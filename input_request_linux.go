@@ -0,0 +1,87 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// readSyscalls are the numbers of the read and readv syscalls by GOARCH, whose
+// first argument is the file descriptor being read.
+var readSyscalls = map[string][]int64{
+	"386":     {3, 145},
+	"amd64":   {0, 19},
+	"arm":     {3, 145},
+	"arm64":   {63, 65},
+	"riscv64": {63, 65},
+}
+
+// inputRequested reports whether a thread of any process is blocked reading
+// the tty at path.
+func inputRequested(path string) (bool, error) {
+	nrs, ok := readSyscalls[runtime.GOARCH]
+	if !ok {
+		return false, ErrInputRequestUnsupported
+	}
+
+	tasks, err := filepath.Glob("/proc/[0-9]*/task/[0-9]*/syscall")
+	if err != nil {
+		return false, err
+	}
+	for _, task := range tasks {
+		// Processes that can't be inspected or exited in the meantime are
+		// skipped.
+		b, err := ioutil.ReadFile(task)
+		if err != nil {
+			continue
+		}
+
+		// The syscall a thread is blocked in is given as its number followed by
+		// its arguments in hex, or "running" if it isn't blocked.
+		fields := strings.Fields(string(b))
+		if len(fields) < 2 {
+			continue
+		}
+		nr, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil || !containsSyscall(nrs, nr) {
+			continue
+		}
+		fd, err := strconv.ParseInt(strings.TrimPrefix(fields[1], "0x"), 16, 64)
+		if err != nil {
+			continue
+		}
+
+		proc := filepath.Dir(filepath.Dir(filepath.Dir(task)))
+		link, err := os.Readlink(filepath.Join(proc, "fd", strconv.FormatInt(fd, 10)))
+		if err == nil && link == path {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func containsSyscall(nrs []int64, nr int64) bool {
+	for _, n := range nrs {
+		if n == nr {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaitForInputRequest(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t)
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	// Nothing reads from the tty yet.
+	err = c.WaitForInputRequest(50 * time.Millisecond)
+	require.True(t, os.IsTimeout(err), "unexpected error: %v", err)
+	var timeoutErr *TimeoutError
+	require.True(t, errors.As(err, &timeoutErr), "unexpected error: %v", err)
+
+	const delay = 200 * time.Millisecond
+	cmd := exec.Command("sh", "-c", "sleep 0.2; read answer; echo got $answer")
+	cmd.Stdin = c.Tty()
+	cmd.Stdout = c.Tty()
+	cmd.Stderr = c.Tty()
+	require.NoError(t, cmd.Start())
+	defer cmd.Wait()
+
+	start := time.Now()
+	require.NoError(t, c.WaitForInputRequest(5*time.Second))
+	require.True(t, time.Since(start) >= delay/2, "returned before the program read its input")
+
+	_, err = c.SendLine("yes")
+	require.NoError(t, err)
+	_, err = c.ExpectString("got yes")
+	require.NoError(t, err)
+}
@@ -0,0 +1,125 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// Interact hands Console's tty over to a user, like expect's interact: what
+// is read from stdin is sent to the tty, and the tty's output is written to
+// stdout, until either reaches EOF, e.g. once the user closes stdin or the pts
+// is closed after the program exits. It is typically called after automating
+// the first steps of a session, with os.Stdin and os.Stdout.
+//
+// If stdin is a terminal, its size is applied to the tty and changes to it are
+// propagated for the duration. The user's terminal is left as is, so callers
+// wanting keys such as Ctrl-C to be sent to the program rather than handled
+// locally should put it in raw mode first. Output is only written to stdout,
+// not to Console's stdouts.
+//
+// When Interact returns, the tty can be used with Expect and Send again. As
+// reading stdin can't be interrupted, a read in progress at that point is
+// discarded once it completes. EOF from either side isn't an error.
+func (c *Console) Interact(stdin io.Reader, stdout io.Writer) error {
+	if c.Closed() {
+		return ErrClosed
+	}
+	if err := c.setReadDeadline(time.Time{}); err != nil {
+		return err
+	}
+
+	stopResize := c.forwardResize(stdin)
+	defer stopResize()
+
+	doneC := make(chan struct{})
+	stdinC := make(chan error, 1)
+	go func() {
+		p := make([]byte, 4096)
+		for {
+			n, err := stdin.Read(p)
+			if n > 0 {
+				select {
+				case <-doneC:
+					return
+				default:
+				}
+				if _, werr := c.Write(p[:n]); werr != nil {
+					stdinC <- werr
+					return
+				}
+			}
+			if err != nil {
+				stdinC <- err
+				return
+			}
+		}
+	}()
+
+	outputC := make(chan error, 1)
+	go func() {
+		outputC <- c.copyOutput(stdout)
+	}()
+
+	var err error
+	select {
+	case err = <-outputC:
+		close(doneC)
+	case err = <-stdinC:
+		close(doneC)
+		// Interrupt the output copy so the tty can be read again.
+		if derr := c.setReadDeadline(time.Now()); derr != nil {
+			return derr
+		}
+		if oerr := <-outputC; err == io.EOF && !os.IsTimeout(oerr) {
+			err = oerr
+		}
+		if derr := c.setReadDeadline(time.Time{}); derr != nil && err == nil {
+			err = derr
+		}
+	}
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// copyOutput copies the output of Console's tty to w and its screen, if any,
+// until reading fails. EOF, including from a closed pts, is returned as
+// io.EOF.
+func (c *Console) copyOutput(w io.Writer) error {
+	if c.screen != nil {
+		w = io.MultiWriter(w, c.screen)
+	}
+	p := make([]byte, 4096)
+	for {
+		n, err := c.runeReader.Read(p)
+		c.stats.received(n)
+		if n > 0 {
+			c.Logf("interact read: %q", p[:n])
+			if _, werr := w.Write(p[:n]); werr != nil {
+				return werr
+			}
+		}
+		if err != nil {
+			if isEOF(err) {
+				return io.EOF
+			}
+			return err
+		}
+	}
+}
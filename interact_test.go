@@ -0,0 +1,97 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInteract(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t)
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	stdinReader, stdinWriter := io.Pipe()
+	stdout := new(lockedBuffer)
+	errC := make(chan error, 1)
+	go func() {
+		errC <- c.Interact(stdinReader, stdout)
+	}()
+
+	// Input from stdin reaches the program.
+	_, err = stdinWriter.Write([]byte("hello\n"))
+	require.NoError(t, err)
+	line, err := bufio.NewReader(c.Tty()).ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "hello\n", line)
+
+	// Output from the program reaches stdout.
+	_, err = c.Tty().WriteString("world\n")
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return strings.Contains(stdout.String(), "world\r\n")
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, stdinWriter.Close())
+	select {
+	case err := <-errC:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Interact did not return after stdin was closed")
+	}
+
+	// The tty is handed back to Expect.
+	_, err = c.Tty().WriteString("after\n")
+	require.NoError(t, err)
+	_, err = c.ExpectString("after")
+	require.NoError(t, err)
+	require.NotContains(t, stdout.String(), "after")
+}
+
+func TestInteractEOF(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewTestConsole(t)
+	require.NoError(t, err)
+	defer c.Close()
+
+	stdinReader, stdinWriter := io.Pipe()
+	defer stdinWriter.Close()
+	stdout := new(lockedBuffer)
+	errC := make(chan error, 1)
+	go func() {
+		errC <- c.Interact(stdinReader, stdout)
+	}()
+
+	_, err = c.Tty().WriteString("bye\n")
+	require.NoError(t, err)
+	require.NoError(t, c.Tty().Close())
+	select {
+	case err := <-errC:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Interact did not return after the pts was closed")
+	}
+	require.Equal(t, "bye\r\n", stdout.String())
+
+}
@@ -0,0 +1,67 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package expect
+
+import (
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/creack/pty"
+)
+
+// forwardResize applies the size of stdin, if it is a terminal, to Console's
+// tty, and again on each SIGWINCH until stop is called.
+func (c *Console) forwardResize(stdin io.Reader) (stop func()) {
+	f, ok := stdin.(*os.File)
+	if !ok {
+		return func() {}
+	}
+	resize := func() error {
+		size, err := pty.GetsizeFull(f)
+		if err != nil {
+			return err
+		}
+		if err := c.SetWinSize(size.Rows, size.Cols); err != nil {
+			c.Logf("failed to forward window size: %s", err)
+		}
+		return nil
+	}
+	if err := resize(); err != nil {
+		return func() {}
+	}
+
+	sigC := make(chan os.Signal, 1)
+	signal.Notify(sigC, syscall.SIGWINCH)
+	doneC := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-sigC:
+				resize()
+			case <-doneC:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sigC)
+		close(doneC)
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"time"
+)
+
+// Latency is a range of artificial delays, see WithReadLatency and
+// WithWriteLatency.
+type Latency struct {
+	Min time.Duration
+	Max time.Duration
+}
+
+// newLatency returns the Latency between min and max, or an error if the range
+// is invalid.
+func newLatency(min, max time.Duration) (Latency, error) {
+	if min < 0 || max < min {
+		return Latency{}, fmt.Errorf("invalid latency range [%s, %s]", min, max)
+	}
+	return Latency{Min: min, Max: max}, nil
+}
+
+// delay returns a delay drawn uniformly from the range.
+func (l Latency) delay() time.Duration {
+	if l.Max <= l.Min {
+		return l.Min
+	}
+	return l.Min + time.Duration(rand.Int63n(int64(l.Max-l.Min)+1))
+}
+
+// sleep waits for a delay drawn from the range.
+func (l Latency) sleep() {
+	if d := l.delay(); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// WithReadLatency delays each chunk of output read from Console's tty by a
+// duration drawn uniformly between min and max, to simulate laggy I/O in tests
+// and chaos simulations. Expect sees the same content, only later.
+func WithReadLatency(min, max time.Duration) ConsoleOpt {
+	return func(opts *ConsoleOpts) error {
+		latency, err := newLatency(min, max)
+		if err != nil {
+			return err
+		}
+		opts.ReadLatency = latency
+		return nil
+	}
+}
+
+// WithWriteLatency delays each Send and Write to Console's tty by a duration
+// drawn uniformly between min and max, to simulate laggy I/O in tests and chaos
+// simulations.
+func WithWriteLatency(min, max time.Duration) ConsoleOpt {
+	return func(opts *ConsoleOpts) error {
+		latency, err := newLatency(min, max)
+		if err != nil {
+			return err
+		}
+		opts.WriteLatency = latency
+		return nil
+	}
+}
+
+// latencyReader delays each chunk read from its reader.
+type latencyReader struct {
+	reader  io.Reader
+	latency Latency
+}
+
+func (lr *latencyReader) Read(p []byte) (int, error) {
+	n, err := lr.reader.Read(p)
+	if n > 0 {
+		lr.latency.sleep()
+	}
+	return n, err
+}
+
+// WithReadRateLimit limits how fast output is read from Console's tty to
+// bytesPerSecond, to simulate a slow terminal in tests and chaos simulations.
+// Output the program writes faster than that fills the pty's buffer, so that
+// the program eventually blocks writing, as with a slow consumer. Reads are
+// throttled with a token bucket that allows bursts of a hundredth of a second
+// of output.
+func WithReadRateLimit(bytesPerSecond int) ConsoleOpt {
+	return func(opts *ConsoleOpts) error {
+		if bytesPerSecond <= 0 {
+			return fmt.Errorf("invalid read rate limit %d", bytesPerSecond)
+		}
+		opts.ReadRateLimit = bytesPerSecond
+		return nil
+	}
+}
+
+// rateLimitReader limits the rate of reads from its reader with a token
+// bucket holding up to burst bytes, which refills at rate bytes per second.
+type rateLimitReader struct {
+	reader io.Reader
+	rate   int
+	burst  int
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimitReader(reader io.Reader, rate int) *rateLimitReader {
+	burst := rate / 100
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimitReader{
+		reader: reader,
+		rate:   rate,
+		burst:  burst,
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Read reads at most a burst at a time, then waits until the bytes read are
+// paid for by the tokens refilled in the meantime.
+func (rr *rateLimitReader) Read(p []byte) (int, error) {
+	if len(p) > rr.burst {
+		p = p[:rr.burst]
+	}
+	n, err := rr.reader.Read(p)
+	if n == 0 {
+		return n, err
+	}
+
+	now := time.Now()
+	rr.tokens += now.Sub(rr.last).Seconds() * float64(rr.rate)
+	if rr.tokens > float64(rr.burst) {
+		rr.tokens = float64(rr.burst)
+	}
+	rr.last = now
+
+	rr.tokens -= float64(n)
+	if rr.tokens < 0 {
+		time.Sleep(time.Duration(-rr.tokens / float64(rr.rate) * float64(time.Second)))
+	}
+	return n, err
+}
@@ -0,0 +1,94 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testLatency = 50 * time.Millisecond
+
+func TestWithReadLatency(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t, WithReadLatency(testLatency, 2*testLatency))
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	_, err = c.Tty().WriteString("Hello world")
+	require.NoError(t, err)
+
+	start := time.Now()
+	out, err := c.ExpectString("world")
+	require.NoError(t, err)
+	require.Equal(t, "Hello world", out)
+	require.True(t, time.Since(start) >= testLatency, "expected a delay of at least %s", testLatency)
+}
+
+func TestWithWriteLatency(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t, WithWriteLatency(testLatency, testLatency))
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	start := time.Now()
+	_, err = c.SendLine("hello")
+	require.NoError(t, err)
+	require.True(t, time.Since(start) >= testLatency, "expected a delay of at least %s", testLatency)
+
+	out, err := c.ExpectString("hello")
+	require.NoError(t, err)
+	require.Equal(t, "hello", out)
+}
+
+func TestWithReadRateLimit(t *testing.T) {
+	t.Parallel()
+
+	const rate = 2000
+	c, err := newTestConsole(t, WithReadRateLimit(rate))
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	data := strings.Repeat("x", 299) + "!"
+	start := time.Now()
+	_, err = c.Tty().WriteString(data)
+	require.NoError(t, err)
+
+	out, err := c.ExpectString("!")
+	require.NoError(t, err)
+	require.Equal(t, data, out)
+
+	// The first burst of a hundredth of a second is read without waiting.
+	expected := time.Duration(len(data)-rate/100) * time.Second / rate
+	require.True(t, time.Since(start) >= expected, "expected the transfer to take at least %s", expected)
+}
+
+func TestLatencyRange(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewConsole(WithReadLatency(2*testLatency, testLatency))
+	require.Error(t, err)
+
+	_, err = NewConsole(WithWriteLatency(-testLatency, testLatency))
+	require.Error(t, err)
+
+	_, err = NewConsole(WithReadRateLimit(0))
+	require.Error(t, err)
+}
@@ -0,0 +1,162 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"bytes"
+	"os"
+	"time"
+	"unicode/utf8"
+)
+
+// literalBufferSize is the initial capacity of the buffer of expectLiteral,
+// which is enough for most prompts without growing.
+const literalBufferSize = 256
+
+// literalEligible reports whether ExpectString can use expectLiteral, which is
+// the case when nothing but the tty's content decides whether s is read.
+func (c *Console) literalEligible(s string) bool {
+	return s != "" &&
+		c.screen == nil &&
+		len(c.opts.ReadMutators) == 0 &&
+		len(c.opts.AutoRules) == 0 &&
+		c.opts.BufferWarnThreshold == 0 &&
+		!c.banner.pending()
+}
+
+// kmpTable returns the failure function of s for Knuth-Morris-Pratt: the
+// length of the longest proper prefix of s[:i+1] that is also its suffix.
+func kmpTable(s string) []int {
+	table := make([]int, len(s))
+	for i, k := 1, 0; i < len(s); i++ {
+		for k > 0 && s[i] != s[k] {
+			k = table[k-1]
+		}
+		if s[i] == s[k] {
+			k++
+		}
+		table[i] = k
+	}
+	return table
+}
+
+// expectLiteral is ExpectString for a Console that is eligible, see
+// literalEligible. It reads like expect does with String(s), with the same
+// results, logs, stats and observers, but matches s incrementally as bytes are
+// read and writes them to the stdouts directly, rather than searching the
+// entire buffer and flushing through a bufio.Writer for every rune. Matching
+// only needs the position in s, but all the content read is still kept rather
+// than a window of len(s) bytes, since it is returned like Expect's buffer.
+func (c *Console) expectLiteral(s string) (out string, err error) {
+	if err := c.ctx.Err(); err != nil {
+		return "", err
+	}
+	if c.Closed() {
+		return "", ErrClosed
+	}
+
+	matcher := &stringMatcher{str: s}
+	matchers := []Matcher{matcher}
+	b := make([]byte, 0, literalBufferSize)
+	var encoded [utf8.UTFMax]byte
+	table := kmpTable(s)
+	matched := 0
+
+	c.inFlight.begin(matchers)
+	defer func() {
+		c.inFlight.end()
+		if ferr := c.stdout.Flush(); ferr != nil && err != nil {
+			c.Logf("failed to write to stdout: %s", ferr)
+		}
+		c.stats.expected(err)
+		for _, observer := range c.opts.ExpectObservers {
+			observer(matchers, string(b), err)
+		}
+		if len(c.opts.MatchObservers) > 0 {
+			var met Matcher
+			if err == nil {
+				met = matcher
+			}
+			match := newMatch(met, b)
+			for _, observer := range c.opts.MatchObservers {
+				observer(match, err)
+			}
+		}
+	}()
+
+	var deadline time.Time
+	if c.opts.ReadTimeout != nil {
+		deadline = time.Now().Add(*c.opts.ReadTimeout)
+	}
+	err = c.setReadDeadline(deadline)
+	if err != nil {
+		return string(b), err
+	}
+
+	for matched < len(s) {
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			err = c.timeoutError(bytes.NewBuffer(b), len(b))
+			return string(b), err
+		}
+
+		var r rune
+		var size int
+		var read []byte
+		r, size, err = c.readRune()
+		if err == nil {
+			read, err = c.incompleteRune(r, size)
+		}
+		if err != nil {
+			if ctxErr := c.ctx.Err(); ctxErr != nil {
+				err = ctxErr
+				return string(b), err
+			}
+			if os.IsTimeout(err) {
+				err = c.timeoutError(bytes.NewBuffer(b), len(b))
+			}
+			return string(b), err
+		}
+
+		if read != nil {
+			c.stats.received(len(read))
+			c.Logf("expect read incomplete rune: %q", read)
+		} else {
+			c.stats.received(size)
+			c.Logf("expect read: %q", string(r))
+			read = encoded[:utf8.EncodeRune(encoded[:], r)]
+		}
+		b = append(b, read...)
+		c.inFlight.received(r)
+		_, err = c.stdout.Write(read)
+		if err != nil {
+			return string(b), err
+		}
+
+		for _, x := range read {
+			for matched > 0 && x != s[matched] {
+				matched = table[matched-1]
+			}
+			if x == s[matched] {
+				matched++
+			}
+			if matched == len(s) {
+				break
+			}
+		}
+	}
+
+	err = c.stdout.Flush()
+	return string(b), err
+}
@@ -0,0 +1,153 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// literalResult is what an Expect for a literal and the Expect after it
+// returned, along with what was observed of the first.
+type literalResult struct {
+	out      string
+	err      string
+	rest     string
+	stdout   string
+	observed string
+	match    string
+	stats    Stats
+}
+
+func expectLiteralResult(t *testing.T, input, s string, fast bool) literalResult {
+	var result literalResult
+	stdout := new(bytes.Buffer)
+	c, err := NewTestConsole(t,
+		WithDefaultTimeout(100*time.Millisecond),
+		WithStdout(stdout),
+		WithExpectObserver(func(matchers []Matcher, buf string, err error) {
+			if result.observed == "" {
+				result.observed = buf
+			}
+		}),
+		WithMatchObserver(func(m *Match, err error) {
+			if result.match == "" {
+				result.match = string(m.Buffer)
+			}
+		}),
+	)
+	require.NoError(t, err)
+	defer testCloser(t, c)
+	require.True(t, c.literalEligible(s))
+
+	_, err = c.Tty().WriteString(input)
+	require.NoError(t, err)
+	require.NoError(t, c.Tty().Close())
+
+	if fast {
+		result.out, err = c.ExpectString(s)
+	} else {
+		result.out, err = c.Expect(String(s))
+	}
+	if err != nil {
+		result.err = err.Error()
+	}
+	result.stats = c.Stats()
+	result.stdout = stdout.String()
+	result.rest, _ = c.ExpectEOF()
+	return result
+}
+
+func TestExpectLiteral(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		title string
+		input string
+		s     string
+	}{
+		{"Match", "login: ", "login: "},
+		{"Partial prefix", "aaab and more", "aab"},
+		{"Multibyte", "café ✓ done", "✓"},
+		{"Incomplete rune", "caf\xc3 done", "done"},
+		{"EOF", "no prompt here", "$ "},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.title, func(t *testing.T) {
+			t.Parallel()
+
+			general := expectLiteralResult(t, test.input, test.s, false)
+			fast := expectLiteralResult(t, test.input, test.s, true)
+			require.Equal(t, general, fast)
+		})
+	}
+}
+
+func TestExpectLiteralTimeout(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewTestConsole(t, WithDefaultTimeout(50*time.Millisecond))
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	_, err = c.Tty().WriteString("waiting")
+	require.NoError(t, err)
+
+	out, err := c.ExpectString("$ ")
+	require.Equal(t, "waiting", out)
+	timeoutErr, ok := err.(*TimeoutError)
+	require.True(t, ok, "unexpected error: %v", err)
+	require.Equal(t, "waiting", timeoutErr.Buffer)
+	require.Equal(t, int64(1), c.Stats().Timeouts)
+}
+
+// BenchmarkExpectString compares ExpectString with the equivalent Expect, which
+// can't take the fast path for a single literal.
+func BenchmarkExpectString(b *testing.B) {
+	data := strings.Repeat("0123456789", 100) + "$ "
+
+	for _, fast := range []bool{false, true} {
+		name := "General"
+		if fast {
+			name = "Fast"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			c, err := NewConsole()
+			require.NoError(b, err)
+			defer c.Close()
+
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, err = c.Tty().WriteString(data)
+				require.NoError(b, err)
+				if fast {
+					_, err = c.ExpectString("$ ")
+				} else {
+					_, err = c.Expect(String("$ "))
+				}
+				require.NoError(b, err)
+			}
+		})
+	}
+}
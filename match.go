@@ -0,0 +1,87 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+// Match describes the outcome of an Expect, as passed to MatchObservers and
+// returned by ExpectMatch, ExpectMatchContext and ExpectScreenMatch, so that
+// wrappers can handle the outcome of any kind of condition the same way.
+type Match struct {
+	// Buffer is the content conditions were matched against: the content read
+	// by Expect, or the rendered screen for ExpectScreen.
+	Buffer string
+
+	// Matched is the condition that was met, or nil if none was. Its Criteria
+	// tell which condition it was, e.g. the string read for String.
+	Matched Matcher
+
+	// Reason is the kind of condition that was met, which tells a matched
+	// pattern apart from EOF or a process exit watched by ProcessExit, like
+	// ExpectReason. It is only meaningful if Matched isn't nil.
+	Reason MatchReason
+
+	// Start and End are the byte offsets of the content in Buffer that met
+	// the condition, such that Buffer[Start:End] is the matched text. Both are
+	// -1 if the condition wasn't met by a located piece of content, e.g. EOF
+	// or Count.
+	Start int
+	End   int
+
+	// Groups holds the matched text followed by the text of each capture group
+	// of a Regexp condition, like regexp.Regexp.FindStringSubmatch. Groups that
+	// didn't participate in the match are empty.
+	Groups []string
+}
+
+// MatchObserver provides an interface for a function callback that will be
+// called after each Expect operation with a description of its outcome. On
+// failure, match only holds the Buffer and err is the error that occurred.
+type MatchObserver func(match *Match, err error)
+
+// locator is implemented by matchers that can report where in a buffer they
+// match.
+type locator interface {
+	// locate returns pairs of offsets of the match and its capture groups in
+	// buf, like regexp.Regexp.FindSubmatchIndex, or nil if there is no match.
+	locate(buf []byte) []int
+}
+
+// newMatch returns the Match for matcher having been met by buf, where matcher
+// is nil if none was.
+func newMatch(matcher Matcher, buf []byte) *Match {
+	m := &Match{
+		Buffer:  string(buf),
+		Matched: matcher,
+		Start:   -1,
+		End:     -1,
+	}
+	if matcher != nil {
+		m.Reason = matchReason(matcher)
+	}
+
+	loc := locate(matcher, buf)
+	if loc == nil {
+		return m
+	}
+
+	m.Start, m.End = loc[0], loc[1]
+	for i := 0; i+1 < len(loc); i += 2 {
+		if loc[i] < 0 {
+			m.Groups = append(m.Groups, "")
+			continue
+		}
+		m.Groups = append(m.Groups, string(buf[loc[i]:loc[i+1]]))
+	}
+	return m
+}
@@ -0,0 +1,118 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpectMatch(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t)
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	_, err = c.Tty().WriteString("What is 1+2? Answer: 3")
+	require.NoError(t, err)
+
+	re := regexp.MustCompile(`(\d)\+(\d)`)
+	match, err := c.ExpectMatch(String("never printed"), Regexp(re))
+	require.NoError(t, err)
+	require.Equal(t, "What is 1+2", match.Buffer)
+	require.Equal(t, re, match.Matched.Criteria())
+	require.Equal(t, MatchedPattern, match.Reason)
+	require.Equal(t, 8, match.Start)
+	require.Equal(t, 11, match.End)
+	require.Equal(t, []string{"1+2", "1", "2"}, match.Groups)
+
+	match, err = c.ExpectMatch(String("Answer"))
+	require.NoError(t, err)
+	require.Equal(t, "? Answer", match.Buffer)
+	require.Equal(t, "Answer", match.Matched.Criteria())
+	require.Equal(t, MatchedPattern, match.Reason)
+	require.Equal(t, 2, match.Start)
+	require.Equal(t, 8, match.End)
+	require.Equal(t, []string{"Answer"}, match.Groups)
+
+	require.NoError(t, c.Tty().Close())
+	match, err = c.ExpectMatch(EOF, PTSClosed)
+	require.NoError(t, err)
+	require.Equal(t, ": 3", match.Buffer)
+	require.NotNil(t, match.Matched)
+	require.Equal(t, MatchedEOF, match.Reason)
+	require.Equal(t, -1, match.Start)
+	require.Equal(t, -1, match.End)
+	require.Nil(t, match.Groups)
+}
+
+func TestExpectMatchError(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewTestConsole(t)
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, err = c.Tty().WriteString("partial")
+	require.NoError(t, err)
+
+	match, err := c.ExpectMatch(String("never printed"), WithTimeout(50*time.Millisecond))
+	require.True(t, errors.Is(err, ErrTimeout), "expected a timeout but got %v", err)
+	require.Equal(t, "partial", match.Buffer)
+	require.Nil(t, match.Matched)
+	require.Equal(t, -1, match.Start)
+	require.Equal(t, -1, match.End)
+}
+
+func TestExpectScreenMatch(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t, WithScreen(2, 10))
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	_, err = c.Tty().WriteString("loading\rready 42!")
+	require.NoError(t, err)
+
+	match, err := c.ExpectScreenMatch(RegexpPattern(`ready (\d+)!`))
+	require.NoError(t, err)
+	require.Equal(t, "ready 42!\n", match.Buffer)
+	require.Equal(t, MatchedPattern, match.Reason)
+	require.Equal(t, 0, match.Start)
+	require.Equal(t, 9, match.End)
+	require.Equal(t, []string{"ready 42!", "42"}, match.Groups)
+}
+
+func TestExpectMatchCount(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t)
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	_, err = c.Tty().WriteString("worker-4 done\nworker-7 done\nworker-2 done\nworker-9 done\n")
+	require.NoError(t, err)
+
+	match, err := c.ExpectMatch(Count(3, RegexpPattern(`worker-(\d+) done`)))
+	require.NoError(t, err)
+	require.Equal(t, []string{"worker-2 done", "2"}, match.Groups)
+	require.Equal(t, "worker-2 done", match.Buffer[match.Start:match.End])
+	require.Equal(t, MatchedPattern, match.Reason)
+}
@@ -0,0 +1,34 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import "errors"
+
+// ErrOutputProcessingUnsupported is returned by SetOutputProcessing on
+// platforms where the pts's termios flags can't be changed.
+var ErrOutputProcessingUnsupported = errors.New("output processing is not supported on this platform")
+
+// SetOutputProcessing turns the pts's output processing (OPOST and ONLCR) on
+// or off. It is on by default, so every "\n" a program writes is read as
+// "\r\n". With it off, output is read exactly as written, which makes
+// captures raw and lets conditions match bare newlines.
+//
+// Interactive programs rely on the translation to return the cursor to the
+// start of the next line, so with it off, lines they write render as a
+// staircase on the screen kept by WithScreen. Programs that set their own
+// terminal modes, such as full screen ones, may turn it back on.
+func (c *Console) SetOutputProcessing(on bool) error {
+	return setOutputProcessing(c.pts, on)
+}
@@ -0,0 +1,46 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetOutputProcessing(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t)
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	require.NoError(t, c.SetOutputProcessing(false))
+	_, err = c.Tty().WriteString("one\ntwo\n")
+	require.NoError(t, err)
+
+	out, err := c.Expect(String("two\n"), WithTimeout(time.Second))
+	require.NoError(t, err)
+	require.Equal(t, "one\ntwo\n", out)
+
+	require.NoError(t, c.SetOutputProcessing(true))
+	_, err = c.Tty().WriteString("three\n")
+	require.NoError(t, err)
+
+	out, err = c.Expect(String("three\r\n"), WithTimeout(time.Second))
+	require.NoError(t, err)
+	require.Equal(t, "three\r\n", out)
+}
@@ -0,0 +1,125 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"fmt"
+	"os/exec"
+	"sync"
+)
+
+// processWatcher waits for a command to exit.
+type processWatcher struct {
+	doneC chan struct{}
+	err   error
+}
+
+// processWatchers tracks the commands being waited for, so that a command is
+// only waited for once no matter how many Expects watch for its exit.
+var processWatchers = struct {
+	sync.Mutex
+	m map[*exec.Cmd]*processWatcher
+}{
+	m: make(map[*exec.Cmd]*processWatcher),
+}
+
+// watchProcess returns the watcher for cmd, starting to wait for it if no one
+// is already.
+func watchProcess(cmd *exec.Cmd) *processWatcher {
+	processWatchers.Lock()
+	defer processWatchers.Unlock()
+
+	if w, ok := processWatchers.m[cmd]; ok {
+		return w
+	}
+
+	w := &processWatcher{doneC: make(chan struct{})}
+	if cmd.ProcessState != nil {
+		// Already waited for, so there is nothing left to watch.
+		if !cmd.ProcessState.Success() {
+			w.err = &exec.ExitError{ProcessState: cmd.ProcessState}
+		}
+		close(w.doneC)
+		return w
+	}
+
+	processWatchers.m[cmd] = w
+	go func() {
+		err := cmd.Wait()
+
+		processWatchers.Lock()
+		delete(processWatchers.m, cmd)
+		processWatchers.Unlock()
+
+		w.err = err
+		close(w.doneC)
+	}()
+	return w
+}
+
+// waitProcess waits for cmd to exit like cmd.Wait, but can be used alongside
+// ProcessExit.
+func waitProcess(cmd *exec.Cmd) error {
+	w := watchProcess(cmd)
+	<-w.doneC
+	return w.err
+}
+
+// processExitMatcher fulfills the Matcher interface to match once a command
+// has exited.
+type processExitMatcher struct {
+	cmd     *exec.Cmd
+	watcher *processWatcher
+}
+
+func (pm *processExitMatcher) Match(v interface{}) bool {
+	select {
+	case <-pm.watcher.doneC:
+		return true
+	default:
+		return false
+	}
+}
+
+func (pm *processExitMatcher) Criteria() interface{} {
+	return pm.cmd
+}
+
+func (pm *processExitMatcher) events() <-chan struct{} {
+	return pm.watcher.doneC
+}
+
+// ProcessExit adds an Expect condition to exit once the started cmd has
+// exited, which ExpectReason reports as MatchedProcessExit. The process is
+// waited for in the background, so cmd.Wait must not be called; once the
+// condition is met, cmd.ProcessState reports how the process exited. Output
+// the process wrote before exiting that has not been read yet is left for the
+// next Expect.
+//
+// If reading from Console's tty reaches EOF first, Expect waits for the
+// process to exit rather than failing, unless EOF is also a condition.
+func ProcessExit(cmd *exec.Cmd) ExpectOpt {
+	return func(opts *ExpectOpts) error {
+		if cmd.Process == nil {
+			return fmt.Errorf("process %s not started", cmd.Path)
+		}
+
+		opts.Matchers = append(opts.Matchers, &processExitMatcher{
+			cmd:     cmd,
+			watcher: watchProcess(cmd),
+		})
+		return nil
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"bytes"
+	"regexp"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// ReadMutator rewrites the buffer that Expect matches against. It is called
+// after each rune read from Console's tty is appended to buf, and may modify
+// the end of buf in place. Read mutations only affect the matched view; the
+// raw bytes are still written to Console's stdouts.
+type ReadMutator func(buf *bytes.Buffer)
+
+// WithReadMutator adds ReadMutators that are applied in order to the buffer
+// matched by Expect.
+func WithReadMutator(mutators ...ReadMutator) ConsoleOpt {
+	return func(opts *ConsoleOpts) error {
+		opts.ReadMutators = append(opts.ReadMutators, mutators...)
+		return nil
+	}
+}
+
+// WithCROverwrite applies carriage return semantics to the buffer matched by
+// Expect: a carriage return that is not followed by a newline resets the
+// current line, so only the content last written to each line remains. This
+// makes matching progress indicators that redraw a line with "\r" reliable.
+func WithCROverwrite() ConsoleOpt {
+	return WithReadMutator(crOverwrite)
+}
+
+func crOverwrite(buf *bytes.Buffer) {
+	b := buf.Bytes()
+	r, size := utf8.DecodeLastRune(b)
+	cr := len(b) - size - 1
+	if r == '\r' || r == '\n' || cr < 0 || b[cr] != '\r' {
+		return
+	}
+
+	// Overwrite the line, including any run of carriage returns, with the rune
+	// that followed them.
+	start := bytes.LastIndexByte(b[:cr], '\n') + 1
+	copy(b[start:], b[cr+1:])
+	buf.Truncate(start + size)
+}
+
+// WithBackspaceProcessing applies backspace semantics to the buffer matched by
+// Expect: a "\b" deletes the rune before it, so programs that correct their
+// output, such as spinners, match as a terminal displays them, e.g.
+// "abcx\bd" as "abcd". A backspace at the start of a line deletes nothing, as
+// the cursor can't move past it. This pairs with WithCROverwrite for programs
+// that redraw lines. The raw bytes are still written to Console's stdouts.
+func WithBackspaceProcessing() ConsoleOpt {
+	return WithReadMutator(backspace)
+}
+
+func backspace(buf *bytes.Buffer) {
+	b := buf.Bytes()
+	if len(b) == 0 || b[len(b)-1] != '\b' {
+		return
+	}
+
+	buf.Truncate(len(b) - 1)
+	r, size := utf8.DecodeLastRune(buf.Bytes())
+	if size == 0 || r == '\n' || r == '\r' {
+		return
+	}
+	buf.Truncate(buf.Len() - size)
+}
+
+// WithCRLFToLF normalizes "\r\n" line endings to "\n" in the buffer matched by
+// Expect, so that patterns written for "\n" line endings, such as `(?m)^ready$`,
+// match the output of programs on a tty, which translates "\n" to "\r\n".
+// Carriage returns not followed by a newline are kept. A "\r\n" split across
+// reads is still normalized, since it is only rewritten once the "\n" is read.
+func WithCRLFToLF() ConsoleOpt {
+	return WithReadMutator(crlfToLF)
+}
+
+// WithCRToLF is like WithCRLFToLF, but also turns carriage returns that are not
+// followed by a newline into newlines. A carriage return at the end of the
+// content read is kept until the next rune is read, as it may start a "\r\n".
+func WithCRToLF() ConsoleOpt {
+	return WithReadMutator(crToLF)
+}
+
+func crlfToLF(buf *bytes.Buffer) {
+	b := buf.Bytes()
+	if bytes.HasSuffix(b, []byte("\r\n")) {
+		b[len(b)-2] = '\n'
+		buf.Truncate(len(b) - 1)
+	}
+}
+
+func crToLF(buf *bytes.Buffer) {
+	b := buf.Bytes()
+	_, size := utf8.DecodeLastRune(b)
+	cr := len(b) - size - 1
+	if cr < 0 || b[cr] != '\r' {
+		return
+	}
+
+	b[cr] = '\n'
+	if b[cr+1] == '\n' {
+		buf.Truncate(cr + 1)
+	}
+}
+
+// byteOrderMark is the UTF-8 encoding of U+FEFF, which some programs, notably
+// on Windows, write at the start of their output.
+const byteOrderMark = "\ufeff"
+
+// WithStripBOM removes a UTF-8 byte order mark from the start of the output of
+// Console's tty in the buffer matched by Expect, so that conditions such as
+// Prefix match the text that follows it. Only the first rune read by Expect is
+// considered. The raw bytes are still written to Console's stdouts.
+func WithStripBOM() ConsoleOpt {
+	return func(opts *ConsoleOpts) error {
+		// Each Console the option is used for reads its own first rune.
+		first := true
+		return WithReadMutator(func(buf *bytes.Buffer) {
+			if !first {
+				return
+			}
+			first = false
+			if buf.String() == byteOrderMark {
+				buf.Reset()
+			}
+		})(opts)
+	}
+}
+
+// WithGraphemeNormalization normalizes the buffer matched by Expect to the
+// given Unicode normalization form, such as norm.NFC, so that logically equal
+// text compares equal regardless of how it was encoded, e.g. "é" as a single
+// code point or as "e" followed by a combining acute accent. Conditions should
+// be written in the same form. The raw bytes are still written to Console's
+// stdouts.
+func WithGraphemeNormalization(form norm.Form) ConsoleOpt {
+	return WithReadMutator(func(buf *bytes.Buffer) {
+		normalize(form, buf)
+	})
+}
+
+// normalize normalizes the last segment of buf, which starts at its last
+// boundary, to form. The content before the boundary was already normalized
+// and can't be affected by the runes that follow it.
+func normalize(form norm.Form, buf *bytes.Buffer) {
+	b := buf.Bytes()
+	start := form.LastBoundary(b)
+	if start < 0 {
+		start = 0
+	}
+	if form.IsNormal(b[start:]) {
+		return
+	}
+
+	segment := form.Bytes(b[start:])
+	buf.Truncate(start)
+	buf.Write(segment)
+}
+
+// WithRegexpScrub rewrites each line in the buffer matched by Expect with
+// regexp.ReplaceAll, so that conditions can ignore variable data such as
+// timestamps or session ids. A line is rewritten once its newline is read, so
+// that matches don't depend on how it was split across reads; until then
+// conditions see it as read. The pattern is applied to the line without its
+// "\n" or "\r\n" ending, and replacement may refer to its submatches like
+// regexp.Regexp.Expand. The raw bytes are still written to Console's stdouts.
+func WithRegexpScrub(pattern, replacement string) ConsoleOpt {
+	return func(opts *ConsoleOpts) error {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return err
+		}
+		return WithReadMutator(func(buf *bytes.Buffer) {
+			scrub(re, []byte(replacement), buf)
+		})(opts)
+	}
+}
+
+// scrub rewrites the line that ends buf with re if buf ends with a newline.
+func scrub(re *regexp.Regexp, replacement []byte, buf *bytes.Buffer) {
+	b := buf.Bytes()
+	if !bytes.HasSuffix(b, []byte("\n")) {
+		return
+	}
+
+	end := len(b) - 1
+	if end > 0 && b[end-1] == '\r' {
+		end--
+	}
+	start := bytes.LastIndexByte(b[:end], '\n') + 1
+	line := re.ReplaceAll(b[start:end], replacement)
+	ending := append([]byte(nil), b[end:]...)
+	buf.Truncate(start)
+	buf.Write(line)
+	buf.Write(ending)
+}
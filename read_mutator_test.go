@@ -0,0 +1,413 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/unicode/norm"
+)
+
+// mutate feeds data to a ConsoleOpt's read mutators one rune at a time, as
+// Expect does, and returns the resulting buffer.
+func mutate(t *testing.T, opt ConsoleOpt, data string) string {
+	var options ConsoleOpts
+	err := opt(&options)
+	require.Nil(t, err)
+
+	buf := new(bytes.Buffer)
+	for _, r := range data {
+		buf.WriteRune(r)
+		for _, mutator := range options.ReadMutators {
+			mutator(buf)
+		}
+	}
+	return buf.String()
+}
+
+func TestWithCROverwrite(t *testing.T) {
+	tests := []struct {
+		title    string
+		data     string
+		expected string
+	}{
+		{
+			"No carriage returns",
+			"Hello world",
+			"Hello world",
+		},
+		{
+			"Progress",
+			"\r10%\r50%\r100%",
+			"100%",
+		},
+		{
+			"Overwrite only current line",
+			"done\n\r10%\r100%",
+			"done\n100%",
+		},
+		{
+			"CRLF is kept",
+			"first\r\nsecond\r\n",
+			"first\r\nsecond\r\n",
+		},
+		{
+			"Pending carriage return",
+			"50%\r",
+			"50%\r",
+		},
+		{
+			"Repeated carriage returns",
+			"50%\r\r1",
+			"1",
+		},
+		{
+			"Multi-byte rune",
+			"abc\ré",
+			"é",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			require.Equal(t, test.expected, mutate(t, WithCROverwrite(), test.data))
+		})
+	}
+}
+
+func TestWithBackspaceProcessing(t *testing.T) {
+	tests := []struct {
+		title    string
+		data     string
+		expected string
+	}{
+		{
+			"Correction",
+			"abcx\bd",
+			"abcd",
+		},
+		{
+			"Spinner",
+			"working |\b/\b-\b\\\bdone",
+			"working done",
+		},
+		{
+			"Multi-byte rune",
+			"caf\u00e9\b\be",
+			"cae",
+		},
+		{
+			"Start of line",
+			"first\n\bsecond",
+			"first\nsecond",
+		},
+		{
+			"Start of output",
+			"\b\bok",
+			"ok",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			require.Equal(t, test.expected, mutate(t, WithBackspaceProcessing(), test.data))
+		})
+	}
+}
+
+func TestWithBackspaceProcessingExpect(t *testing.T) {
+	t.Parallel()
+
+	stdout := new(bytes.Buffer)
+	c, err := newTestConsole(t, WithBackspaceProcessing(), WithStdout(stdout))
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	_, err = c.Tty().WriteString("abcx\bd")
+	require.NoError(t, err)
+
+	out, err := c.ExpectString("abcd")
+	require.NoError(t, err)
+	require.Equal(t, "abcd", out)
+	require.Equal(t, "abcx\bd", stdout.String())
+}
+
+func TestWithCRLFToLF(t *testing.T) {
+	tests := []struct {
+		title    string
+		opt      ConsoleOpt
+		data     string
+		expected string
+	}{
+		{
+			"CRLF",
+			WithCRLFToLF(),
+			"first\r\nsecond\r\n",
+			"first\nsecond\n",
+		},
+		{
+			"Lone carriage return is kept",
+			WithCRLFToLF(),
+			"\r10%\r100%\r\n",
+			"\r10%\r100%\n",
+		},
+		{
+			"Pending carriage return",
+			WithCRLFToLF(),
+			"first\r",
+			"first\r",
+		},
+		{
+			"CR and CRLF",
+			WithCRToLF(),
+			"first\r\nsecond\rthird\r\n",
+			"first\nsecond\nthird\n",
+		},
+		{
+			"Repeated carriage returns",
+			WithCRToLF(),
+			"first\r\r\n",
+			"first\n\n",
+		},
+		{
+			"Pending carriage return before multi-byte rune",
+			WithCRToLF(),
+			"first\ré",
+			"first\né",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			require.Equal(t, test.expected, mutate(t, test.opt, test.data))
+		})
+	}
+}
+
+func TestWithCRLFToLFExpect(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t, WithCRLFToLF())
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	// The tty translates "\n" to "\r\n".
+	_, err = c.Tty().WriteString("booting\nready\n")
+	require.NoError(t, err)
+
+	out, err := c.Expect(RegexpPattern(`(?m)^ready\n`))
+	require.NoError(t, err)
+	require.Equal(t, "booting\nready\n", out)
+}
+
+func TestWithGraphemeNormalization(t *testing.T) {
+	tests := []struct {
+		title    string
+		form     norm.Form
+		data     string
+		expected string
+	}{
+		{
+			"NFC of decomposed",
+			norm.NFC,
+			"cafe\u0301!",
+			"caf\u00e9!",
+		},
+		{
+			"NFC of composed",
+			norm.NFC,
+			"caf\u00e9!",
+			"caf\u00e9!",
+		},
+		{
+			"NFC of multiple combining marks",
+			norm.NFC,
+			"e\u0323\u0302",
+			"\u1ec7",
+		},
+		{
+			"NFD of composed",
+			norm.NFD,
+			"caf\u00e9!",
+			"cafe\u0301!",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			require.Equal(t, test.expected, mutate(t, WithGraphemeNormalization(test.form), test.data))
+		})
+	}
+}
+
+func TestWithGraphemeNormalizationExpect(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t, WithGraphemeNormalization(norm.NFC))
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	// "\u00e9" decomposed into "e" and a combining acute accent.
+	_, err = c.Tty().WriteString("cafe\u0301\n")
+	require.NoError(t, err)
+
+	out, err := c.ExpectString("caf\u00e9\r\n")
+	require.NoError(t, err)
+	require.Equal(t, "caf\u00e9\r\n", out)
+}
+
+func TestWithRegexpScrub(t *testing.T) {
+	tests := []struct {
+		title       string
+		pattern     string
+		replacement string
+		data        string
+		expected    string
+	}{
+		{
+			"Timestamp",
+			`\d{2}:\d{2}:\d{2}`,
+			"<time>",
+			"[12:34:56] started\r\n[12:34:57] ready\r\n",
+			"[<time>] started\r\n[<time>] ready\r\n",
+		},
+		{
+			"Incomplete line",
+			`\d{2}:\d{2}:\d{2}`,
+			"<time>",
+			"[12:34:56] started\n[12:34:57] rea",
+			"[<time>] started\n[12:34:57] rea",
+		},
+		{
+			"Submatches",
+			`^session ([a-z]+)-[0-9a-f]+$`,
+			"session $1-<id>",
+			"session web-8f3a2c\n",
+			"session web-<id>\n",
+		},
+		{
+			"No match",
+			`\d{2}:\d{2}:\d{2}`,
+			"<time>",
+			"ready\n",
+			"ready\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			out := mutate(t, WithRegexpScrub(test.pattern, test.replacement), test.data)
+			require.Equal(t, test.expected, out)
+		})
+	}
+}
+
+func TestWithRegexpScrubInvalid(t *testing.T) {
+	var options ConsoleOpts
+	err := WithRegexpScrub(`(`, "")(&options)
+	require.Error(t, err)
+}
+
+func TestWithRegexpScrubExpect(t *testing.T) {
+	t.Parallel()
+
+	stdout := new(lockedBuffer)
+	c, err := newTestConsole(t, WithStdout(stdout), WithRegexpScrub(`^\[[0-9:.]+\] `, ""))
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	_, err = c.Tty().WriteString("[10:00:00.123] booting\n[10:00:01.456] ready\n")
+	require.NoError(t, err)
+
+	// Lines are only scrubbed once complete, so the line is matched along
+	// with its newline.
+	out, err := c.Expect(RegexpPattern(`(?m)^ready\r$`))
+	require.NoError(t, err)
+	require.Equal(t, "booting\r\nready\r\n", out)
+
+	// The raw output is still written to stdout.
+	require.Equal(t, "[10:00:00.123] booting\r\n[10:00:01.456] ready\r\n", stdout.String())
+}
+
+func TestWithStripBOM(t *testing.T) {
+	tests := []struct {
+		title    string
+		data     string
+		expected string
+	}{
+		{
+			"Leading BOM",
+			"\xef\xbb\xbfbanner",
+			"banner",
+		},
+		{
+			"No BOM",
+			"banner",
+			"banner",
+		},
+		{
+			"Later BOM",
+			"banner\xef\xbb\xbf",
+			"banner\xef\xbb\xbf",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			out := mutate(t, WithStripBOM(), test.data)
+			require.Equal(t, test.expected, out)
+		})
+	}
+}
+
+func TestWithStripBOMExpect(t *testing.T) {
+	t.Parallel()
+
+	stdout := new(lockedBuffer)
+	c, err := newTestConsole(t, WithStdout(stdout), WithStripBOM())
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	_, err = c.Tty().WriteString("\xef\xbb\xbfWelcome to tool v1.0")
+	require.NoError(t, err)
+
+	out, err := c.Expect(Prefix("Welcome"))
+	require.NoError(t, err)
+	require.Equal(t, "Welcome", out)
+
+	// The raw output is still written to stdout.
+	require.Equal(t, "\xef\xbb\xbfWelcome", stdout.String())
+}
+
+func TestWithStripBOMReused(t *testing.T) {
+	t.Parallel()
+
+	// The same option strips the BOM of each Console it is used for.
+	stripBOM := WithStripBOM()
+	for i := 0; i < 2; i++ {
+		c, err := newTestConsole(t, stripBOM)
+		require.NoError(t, err)
+
+		_, err = c.Tty().WriteString("\xef\xbb\xbfWelcome")
+		require.NoError(t, err)
+
+		out, err := c.Expect(Prefix("Welcome"))
+		require.NoError(t, err, "console %d", i)
+		require.Equal(t, "Welcome", out, "console %d", i)
+		testCloser(t, c)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+)
+
+// ReaderMux passes through reads from an underlying io.Reader and provides
+// cancellable io.Readers that each receive a copy of the bytes read. Unlike
+// ReaderLease, readers from ReaderMux never take bytes away from callers of
+// Read.
+type ReaderMux struct {
+	reader  io.Reader
+	mu      sync.Mutex
+	readers map[*muxReader]struct{}
+	ended   bool
+}
+
+// NewReaderMux returns a new ReaderMux over the given io.Reader.
+func NewReaderMux(reader io.Reader) *ReaderMux {
+	return &ReaderMux{
+		reader:  reader,
+		readers: make(map[*muxReader]struct{}),
+	}
+}
+
+// Read reads from the underlying io.Reader and copies the bytes read to every
+// reader from NewReader. Once the underlying io.Reader returns an error, the
+// readers return io.EOF after their remaining bytes are read.
+func (rm *ReaderMux) Read(p []byte) (int, error) {
+	n, err := rm.reader.Read(p)
+
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	for mr := range rm.readers {
+		mr.write(p[:n])
+	}
+	if err != nil {
+		rm.ended = true
+		for mr := range rm.readers {
+			mr.close()
+		}
+		rm.readers = nil
+	}
+	return n, err
+}
+
+// NewReader returns a cancellable io.Reader that receives a copy of every byte
+// read through ReaderMux from now on. Bytes are buffered until read, so a slow
+// reader never blocks ReaderMux. Once ctx is cancelled, future Reads will
+// return io.EOF.
+func (rm *ReaderMux) NewReader(ctx context.Context) io.Reader {
+	mr := &muxReader{
+		ctx:   ctx,
+		doneC: make(chan struct{}),
+	}
+	mr.cond = sync.NewCond(&mr.mu)
+
+	rm.mu.Lock()
+	if rm.ended {
+		mr.close()
+	} else {
+		rm.readers[mr] = struct{}{}
+	}
+	rm.mu.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			rm.mu.Lock()
+			delete(rm.readers, mr)
+			rm.mu.Unlock()
+			mr.close()
+		case <-mr.doneC:
+		}
+	}()
+
+	return mr
+}
+
+// muxReader is a buffered io.Reader fed by ReaderMux.
+type muxReader struct {
+	ctx    context.Context
+	mu     sync.Mutex
+	cond   *sync.Cond
+	buf    bytes.Buffer
+	closed bool
+	doneC  chan struct{}
+}
+
+func (mr *muxReader) write(p []byte) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	mr.buf.Write(p)
+	mr.cond.Broadcast()
+}
+
+func (mr *muxReader) close() {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	if mr.closed {
+		return
+	}
+	mr.closed = true
+	close(mr.doneC)
+	mr.cond.Broadcast()
+}
+
+func (mr *muxReader) Read(p []byte) (int, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	for mr.buf.Len() == 0 && !mr.closed {
+		mr.cond.Wait()
+	}
+	if mr.ctx.Err() != nil || mr.buf.Len() == 0 {
+		return 0, io.EOF
+	}
+	return mr.buf.Read(p)
+}
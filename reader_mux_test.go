@@ -0,0 +1,65 @@
+package expect
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReaderMux(t *testing.T) {
+	rm := NewReaderMux(strings.NewReader("apple banana"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	first := rm.NewReader(ctx)
+	second := rm.NewReader(ctx)
+
+	// Bytes read through ReaderMux are not stolen by its readers.
+	data, err := ioutil.ReadAll(rm)
+	require.NoError(t, err)
+	require.Equal(t, "apple banana", string(data))
+
+	for _, reader := range []io.Reader{first, second} {
+		data, err = ioutil.ReadAll(reader)
+		require.NoError(t, err)
+		require.Equal(t, "apple banana", string(data))
+	}
+
+	// Readers created after the underlying reader ends return io.EOF.
+	p := make([]byte, 1)
+	_, err = rm.NewReader(ctx).Read(p)
+	require.Equal(t, io.EOF, err)
+}
+
+func TestReaderMuxCancel(t *testing.T) {
+	in, out := io.Pipe()
+	defer out.Close()
+	defer in.Close()
+
+	rm := NewReaderMux(in)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reader := rm.NewReader(ctx)
+
+	go func() {
+		out.Write([]byte("a"))
+	}()
+
+	p := make([]byte, 1)
+	n, err := rm.Read(p)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	n, err = reader.Read(p)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.Equal(t, byte('a'), p[0])
+
+	cancel()
+	_, err = reader.Read(p)
+	require.Equal(t, io.EOF, err)
+}
@@ -0,0 +1,421 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// screenState is the state of the escape sequence parser.
+type screenState int
+
+const (
+	stateGround screenState = iota
+	stateEscape
+	stateCharset
+	stateCSI
+	stateOSC
+	stateOSCEscape
+)
+
+// screen is a minimal terminal emulator that maintains a grid of cells by
+// interpreting the common subset of ANSI/VT100 control sequences that move
+// the cursor and erase or scroll content. Graphic renditions and other
+// sequences that don't affect the text on screen are ignored.
+type screen struct {
+	mu       sync.Mutex
+	rows     int
+	cols     int
+	cells    [][]rune
+	row      int
+	col      int
+	savedRow int
+	savedCol int
+	// wrap is set when a rune was written to the last column, and the next
+	// printable rune should wrap to the next line.
+	wrap    bool
+	state   screenState
+	params  []byte
+	partial []byte
+}
+
+func newScreen(rows, cols int) *screen {
+	s := &screen{
+		rows: rows,
+		cols: cols,
+	}
+	s.reset()
+	return s
+}
+
+// reset clears the screen and returns the parser to its initial state.
+func (s *screen) reset() {
+	s.cells = make([][]rune, s.rows)
+	for i := range s.cells {
+		s.cells[i] = blankLine(s.cols)
+	}
+	s.row, s.col = 0, 0
+	s.savedRow, s.savedCol = 0, 0
+	s.wrap = false
+	s.state = stateGround
+}
+
+// resize changes the size of the screen, keeping the content that still fits
+// at the top left.
+func (s *screen) resize(rows, cols int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cells := make([][]rune, rows)
+	for i := range cells {
+		cells[i] = blankLine(cols)
+		if i < len(s.cells) {
+			copy(cells[i], s.cells[i])
+		}
+	}
+	s.rows, s.cols, s.cells = rows, cols, cells
+	s.moveTo(s.row, s.col)
+	s.savedRow, s.savedCol = clamp(s.savedRow, rows), clamp(s.savedCol, cols)
+}
+
+// clamp returns n limited to the range [0, size).
+func clamp(n, size int) int {
+	if n >= size {
+		return size - 1
+	}
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+func blankLine(cols int) []rune {
+	line := make([]rune, cols)
+	for i := range line {
+		line[i] = ' '
+	}
+	return line
+}
+
+// Write interprets p as terminal output. Runes split across writes are
+// buffered until complete.
+func (s *screen) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := append(s.partial, p...)
+	for len(b) > 0 {
+		if !utf8.FullRune(b) {
+			break
+		}
+		r, size := utf8.DecodeRune(b)
+		s.put(r)
+		b = b[size:]
+	}
+	s.partial = append([]byte(nil), b...)
+	return len(p), nil
+}
+
+// String returns the text on screen, one line per row with trailing spaces
+// removed.
+func (s *screen) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lines := make([]string, s.rows)
+	for i, line := range s.cells {
+		lines[i] = strings.TrimRight(string(line), " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// cursor returns the position of the cursor.
+func (s *screen) cursor() Cursor {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return Cursor{Row: s.row, Col: s.col}
+}
+
+func (s *screen) put(r rune) {
+	switch s.state {
+	case stateEscape:
+		s.escape(r)
+		return
+	case stateCharset:
+		s.state = stateGround
+		return
+	case stateCSI:
+		if r >= 0x40 && r <= 0x7e {
+			s.csi(r)
+			s.state = stateGround
+		} else {
+			s.params = append(s.params, byte(r))
+		}
+		return
+	case stateOSC:
+		switch r {
+		case '\a':
+			s.state = stateGround
+		case '\x1b':
+			s.state = stateOSCEscape
+		}
+		return
+	case stateOSCEscape:
+		if r == '\\' {
+			s.state = stateGround
+		} else {
+			s.state = stateOSC
+		}
+		return
+	}
+
+	switch r {
+	case '\x1b':
+		s.state = stateEscape
+	case '\r':
+		s.col = 0
+		s.wrap = false
+	case '\n', '\v', '\f':
+		s.lineFeed()
+	case '\b':
+		if s.col > 0 {
+			s.col--
+		}
+		s.wrap = false
+	case '\t':
+		s.col = (s.col/8 + 1) * 8
+		if s.col >= s.cols {
+			s.col = s.cols - 1
+		}
+	default:
+		if r < ' ' || r == 0x7f {
+			return
+		}
+		if s.wrap {
+			s.col = 0
+			s.lineFeed()
+		}
+		s.cells[s.row][s.col] = r
+		if s.col == s.cols-1 {
+			s.wrap = true
+		} else {
+			s.col++
+		}
+	}
+}
+
+func (s *screen) escape(r rune) {
+	s.state = stateGround
+	switch r {
+	case '[':
+		s.state = stateCSI
+		s.params = s.params[:0]
+	case ']':
+		s.state = stateOSC
+	case '(', ')', '*', '+':
+		s.state = stateCharset
+	case '7':
+		s.savedRow, s.savedCol = s.row, s.col
+	case '8':
+		s.moveTo(s.savedRow, s.savedCol)
+	case 'D':
+		s.lineFeed()
+	case 'E':
+		s.col = 0
+		s.lineFeed()
+	case 'M':
+		if s.row == 0 {
+			s.scrollDown(1)
+		} else {
+			s.row--
+		}
+	case 'c':
+		s.reset()
+	}
+}
+
+// csiParams parses the numeric parameters of a control sequence, using def
+// for missing, zero or negative parameters.
+func (s *screen) csiParams(def int) []int {
+	var params []int
+	for _, p := range strings.Split(string(s.params), ";") {
+		n, err := strconv.Atoi(strings.TrimLeft(p, "?>="))
+		if err != nil || n <= 0 {
+			n = def
+		}
+		params = append(params, n)
+	}
+	return params
+}
+
+func (s *screen) csi(final rune) {
+	if strings.HasPrefix(string(s.params), "?") {
+		// Private modes don't affect the text on screen.
+		return
+	}
+
+	params := s.csiParams(1)
+	n := params[0]
+	switch final {
+	case 'A':
+		s.moveTo(s.row-n, s.col)
+	case 'B':
+		s.moveTo(s.row+n, s.col)
+	case 'C':
+		s.moveTo(s.row, s.col+n)
+	case 'D':
+		s.moveTo(s.row, s.col-n)
+	case 'E':
+		s.moveTo(s.row+n, 0)
+	case 'F':
+		s.moveTo(s.row-n, 0)
+	case 'G', '`':
+		s.moveTo(s.row, n-1)
+	case 'd':
+		s.moveTo(n-1, s.col)
+	case 'H', 'f':
+		col := 1
+		if len(params) > 1 {
+			col = params[1]
+		}
+		s.moveTo(n-1, col-1)
+	case 'J':
+		s.eraseDisplay(s.csiParams(0)[0])
+	case 'K':
+		s.eraseLine(s.csiParams(0)[0])
+	case 'X':
+		for i := s.col; i < s.col+n && i < s.cols; i++ {
+			s.cells[s.row][i] = ' '
+		}
+	case 'P':
+		line := s.cells[s.row]
+		if n > s.cols-s.col {
+			n = s.cols - s.col
+		}
+		copy(line[s.col:], line[s.col+n:])
+		for i := s.cols - n; i < s.cols; i++ {
+			line[i] = ' '
+		}
+	case '@':
+		line := s.cells[s.row]
+		if n > s.cols-s.col {
+			n = s.cols - s.col
+		}
+		copy(line[s.col+n:], line[s.col:])
+		for i := s.col; i < s.col+n; i++ {
+			line[i] = ' '
+		}
+	case 'L':
+		s.insertLines(s.row, n)
+	case 'M':
+		s.deleteLines(s.row, n)
+	case 'S':
+		s.scrollUp(n)
+	case 'T':
+		s.scrollDown(n)
+	case 's':
+		s.savedRow, s.savedCol = s.row, s.col
+	case 'u':
+		s.moveTo(s.savedRow, s.savedCol)
+	}
+}
+
+func (s *screen) moveTo(row, col int) {
+	if row < 0 {
+		row = 0
+	} else if row >= s.rows {
+		row = s.rows - 1
+	}
+	if col < 0 {
+		col = 0
+	} else if col >= s.cols {
+		col = s.cols - 1
+	}
+	s.row, s.col = row, col
+	s.wrap = false
+}
+
+func (s *screen) lineFeed() {
+	s.wrap = false
+	if s.row == s.rows-1 {
+		s.scrollUp(1)
+		return
+	}
+	s.row++
+}
+
+func (s *screen) scrollUp(n int) {
+	s.deleteLines(0, n)
+}
+
+func (s *screen) scrollDown(n int) {
+	s.insertLines(0, n)
+}
+
+func (s *screen) insertLines(row, n int) {
+	if n > s.rows-row {
+		n = s.rows - row
+	}
+	copy(s.cells[row+n:], s.cells[row:s.rows-n])
+	for i := row; i < row+n; i++ {
+		s.cells[i] = blankLine(s.cols)
+	}
+}
+
+func (s *screen) deleteLines(row, n int) {
+	if n > s.rows-row {
+		n = s.rows - row
+	}
+	copy(s.cells[row:], s.cells[row+n:])
+	for i := s.rows - n; i < s.rows; i++ {
+		s.cells[i] = blankLine(s.cols)
+	}
+}
+
+func (s *screen) eraseDisplay(mode int) {
+	switch mode {
+	case 0:
+		s.eraseLine(0)
+		for i := s.row + 1; i < s.rows; i++ {
+			s.cells[i] = blankLine(s.cols)
+		}
+	case 1:
+		s.eraseLine(1)
+		for i := 0; i < s.row; i++ {
+			s.cells[i] = blankLine(s.cols)
+		}
+	case 2, 3:
+		for i := range s.cells {
+			s.cells[i] = blankLine(s.cols)
+		}
+	}
+}
+
+func (s *screen) eraseLine(mode int) {
+	start, end := s.col, s.cols
+	switch mode {
+	case 1:
+		start, end = 0, s.col+1
+	case 2:
+		start = 0
+	}
+	for i := start; i < end; i++ {
+		s.cells[s.row][i] = ' '
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScreen(t *testing.T) {
+	tests := []struct {
+		title    string
+		data     string
+		expected string
+	}{
+		{
+			"Plain text",
+			"Hello\r\nworld",
+			"Hello\nworld\n",
+		},
+		{
+			"Cursor position",
+			"\x1b[2;3Hab\x1b[1;1Hcd",
+			"cd\n  ab\n",
+		},
+		{
+			"Relative movement",
+			"a\x1b[Bb\x1b[2Dc\x1b[Ad",
+			"ad\ncb\n",
+		},
+		{
+			"Erase display",
+			"junk\r\njunk\x1b[2J\x1b[Hclean",
+			"clean\n\n",
+		},
+		{
+			"Erase line",
+			"Hello\x1b[3G\x1b[K",
+			"He\n\n",
+		},
+		{
+			"Overwrite",
+			"10%\r100%",
+			"100%\n\n",
+		},
+		{
+			"Wrap",
+			"abcdefg",
+			"abcde\nfg\n",
+		},
+		{
+			"Scroll",
+			"1\r\n2\r\n3\r\n4",
+			"2\n3\n4",
+		},
+		{
+			"Ignored sequences",
+			"\x1b[1;31mred\x1b[0m\x1b]0;title\x07\x1b[?25l",
+			"red\n\n",
+		},
+		{
+			"Save and restore cursor",
+			"ab\x1b7\x1b[3;1Hc\x1b8d",
+			"abd\n\nc",
+		},
+		{
+			"Split rune",
+			"\xc3",
+			"\n\n",
+		},
+		{
+			"Negative insert characters",
+			"abc\x1b[1G\x1b[-3@",
+			" abc\n\n",
+		},
+		{
+			"Negative delete characters",
+			"abc\x1b[1G\x1b[-3P",
+			"bc\n\n",
+		},
+		{
+			"Negative insert lines",
+			"1\r\n2\r\n3\x1b[1;1H\x1b[-2L",
+			"\n1\n2",
+		},
+		{
+			"Negative delete lines",
+			"1\r\n2\r\n3\x1b[1;1H\x1b[-2M",
+			"2\n3\n",
+		},
+		{
+			"Negative scroll",
+			"1\r\n2\r\n3\x1b[-2S",
+			"2\n3\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			s := newScreen(3, 5)
+			_, err := s.Write([]byte(test.data))
+			require.Nil(t, err)
+			require.Equal(t, test.expected, s.String())
+		})
+	}
+}
+
+func TestScreenSplitRune(t *testing.T) {
+	s := newScreen(1, 5)
+	_, err := s.Write([]byte("\xc3"))
+	require.Nil(t, err)
+	_, err = s.Write([]byte("\xa9"))
+	require.Nil(t, err)
+	require.Equal(t, "é", s.String())
+}
@@ -0,0 +1,73 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"fmt"
+	"sync"
+)
+
+// WithScrollback retains the last n bytes of all output read from Console's
+// tty, available from Scrollback, e.g. to assert on the whole session after a
+// test. Output is retained as soon as it is read from the tty, whether or not
+// it was consumed by Expect.
+func WithScrollback(n int) ConsoleOpt {
+	return func(opts *ConsoleOpts) error {
+		if n <= 0 {
+			return fmt.Errorf("invalid scrollback size %d", n)
+		}
+		opts.Scrollback = n
+		return nil
+	}
+}
+
+// Scrollback returns the last bytes of output read from Console's tty, up to
+// the size set by WithScrollback. Since the oldest bytes are dropped as the
+// output grows, it may start in the middle of a line or a multi-byte rune. If
+// Console has no scrollback, an empty string is returned.
+func (c *Console) Scrollback() string {
+	if c.scrollback == nil {
+		return ""
+	}
+	return c.scrollback.String()
+}
+
+// scrollback is an io.Writer that retains the last size bytes written to it.
+type scrollback struct {
+	mu   sync.Mutex
+	buf  []byte
+	size int
+}
+
+func (sb *scrollback) Write(p []byte) (int, error) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	if len(p) >= sb.size {
+		sb.buf = append(sb.buf[:0], p[len(p)-sb.size:]...)
+		return len(p), nil
+	}
+	if drop := len(sb.buf) + len(p) - sb.size; drop > 0 {
+		sb.buf = append(sb.buf[:0], sb.buf[drop:]...)
+	}
+	sb.buf = append(sb.buf, p...)
+	return len(p), nil
+}
+
+func (sb *scrollback) String() string {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	return string(sb.buf)
+}
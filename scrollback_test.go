@@ -0,0 +1,58 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithScrollback(t *testing.T) {
+	t.Parallel()
+
+	const size = 16
+	c, err := newTestConsole(t, WithScrollback(size))
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	_, err = c.Tty().WriteString("first line\n")
+	require.NoError(t, err)
+	_, err = c.ExpectString("first line")
+	require.NoError(t, err)
+	require.Contains(t, c.Scrollback(), "first line")
+
+	_, err = c.Tty().WriteString("second line\n")
+	require.NoError(t, err)
+	_, err = c.ExpectString("second line\r\n")
+	require.NoError(t, err)
+
+	// The tty translates "\n" to "\r\n".
+	full := "first line\r\nsecond line\r\n"
+	require.Equal(t, full[len(full)-size:], c.Scrollback())
+}
+
+func TestScrollback(t *testing.T) {
+	sb := &scrollback{size: 4}
+
+	sb.Write([]byte("ab"))
+	require.Equal(t, "ab", sb.String())
+
+	sb.Write([]byte("cde"))
+	require.Equal(t, "bcde", sb.String())
+
+	sb.Write([]byte("fghij"))
+	require.Equal(t, "ghij", sb.String())
+}
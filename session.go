@@ -0,0 +1,141 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// Session pairs a Console with a command started on its tty, similar to
+// expect's spawn. It is a thin convenience over Console, which does not
+// otherwise manage process lifecycle.
+type Session struct {
+	*Console
+	Cmd *exec.Cmd
+}
+
+// Spawn starts the named program with the given arguments with its stdin,
+// stdout and stderr connected to a new Console's tty, as its controlling
+// terminal, see Console.Command.
+func Spawn(name string, args ...string) (*Session, error) {
+	c, err := NewConsole()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := c.Command(name, args...)
+	err = cmd.Start()
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return &Session{
+		Console: c,
+		Cmd:     cmd,
+	}, nil
+}
+
+// Command returns an exec.Cmd to run the named program with the given
+// arguments with its stdin, stdout and stderr connected to Console's tty, like
+// exec.Command. Where supported, the program is started in a new session with
+// the tty as its controlling terminal, so that it is the tty's foreground
+// process group, as in an interactive shell: it receives the signals of keys
+// like Ctrl-C, and programs that check for job control, e.g. with tcgetpgrp,
+// don't stop with SIGTTIN or SIGTTOU.
+func (c *Console) Command(name string, args ...string) *exec.Cmd {
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = c.Tty()
+	cmd.Stdout = c.Tty()
+	cmd.Stderr = c.Tty()
+	cmd.SysProcAttr = controllingTerminal()
+	cmd.Env = c.askpass.environ()
+	return cmd
+}
+
+// Wait waits for the command to exit, drains its remaining output until EOF
+// and closes the Console. It may also be used after an Expect with
+// ProcessExit for the command. The error from the command's Wait is returned
+// if non-nil, otherwise any error that occurred while draining.
+func (s *Session) Wait() error {
+	// Drain concurrently so that a command blocked writing to a full tty can
+	// still exit.
+	errC := make(chan error, 1)
+	go func() {
+		_, err := s.ExpectEOF()
+		errC <- err
+	}()
+
+	err := waitProcess(s.Cmd)
+
+	// Close the pts so the drain sees EOF once the command's output is read.
+	s.Tty().Close()
+	drainErr := <-errC
+	s.Close()
+
+	if err != nil {
+		return err
+	}
+	return drainErr
+}
+
+// Collect drains Console's tty while waiting for cmd, a command started on
+// it, to exit, and returns all the output read along with the command's exit
+// error, e.g. to run a program to completion. Draining and waiting happen
+// concurrently, so that a command blocked writing to a full tty can still
+// exit. Once cmd exits, Console's tty is closed so that draining ends at EOF
+// once the remaining output is read; unlike Session.Wait, the Console itself
+// is left open.
+//
+// The timeout bounds the whole call. If it elapses, the output read so far is
+// returned with a *TimeoutError, and cmd is left running. Otherwise the error
+// from the command's Wait is returned if non-nil, then any error that occurred
+// while draining. Like with ProcessExit, cmd.Wait must not be called.
+func (c *Console) Collect(cmd *exec.Cmd, timeout time.Duration) (string, error) {
+	if cmd.Process == nil {
+		return "", fmt.Errorf("process %s not started", cmd.Path)
+	}
+
+	type drained struct {
+		out string
+		err error
+	}
+	drainC := make(chan drained, 1)
+	go func() {
+		out, err := c.Expect(EOF, PTSClosed, WithTimeout(timeout))
+		drainC <- drained{out, err}
+	}()
+
+	w := watchProcess(cmd)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	exited := false
+	select {
+	case <-w.doneC:
+		exited = true
+		c.Tty().Close()
+	case <-timer.C:
+	}
+
+	// Without the process exiting, the drain ends with its own timeout.
+	d := <-drainC
+	if exited && w.err != nil {
+		return d.out, w.err
+	}
+	return d.out, d.err
+}
@@ -0,0 +1,47 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpawnForeground(t *testing.T) {
+	for _, name := range []string{"sh", "awk"} {
+		if _, err := exec.LookPath(name); err != nil {
+			t.Skipf("%s not found in PATH", name)
+		}
+	}
+	t.Parallel()
+
+	// The process group of the shell must be the tty's foreground process
+	// group for its read not to stop it with SIGTTIN.
+	s, err := Spawn("sh", "-c", `awk '{ print ($5 == $8 ? "foreground" : "background") }' /proc/$$/stat; read line; echo "got $line"`)
+	require.NoError(t, err)
+
+	out, err := s.Expect(String("ground"), WithTimeout(time.Second))
+	require.NoError(t, err)
+	require.Equal(t, "foreground", out)
+
+	_, err = s.SendLine("hello")
+	require.NoError(t, err)
+	_, err = s.Expect(String("got hello"), WithTimeout(time.Second))
+	require.NoError(t, err)
+	require.NoError(t, s.Wait())
+}
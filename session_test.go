@@ -0,0 +1,88 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpawn(t *testing.T) {
+	if _, err := exec.LookPath("echo"); err != nil {
+		t.Skip("echo not found in PATH")
+	}
+	t.Parallel()
+
+	s, err := Spawn("echo", "Hello world")
+	require.NoError(t, err)
+
+	out, err := s.ExpectString("Hello world")
+	require.NoError(t, err)
+	require.Equal(t, "Hello world", out)
+
+	err = s.Wait()
+	require.NoError(t, err)
+	require.True(t, s.Cmd.ProcessState.Success())
+}
+
+func TestSpawnNotFound(t *testing.T) {
+	t.Parallel()
+
+	_, err := Spawn("go-expect-does-not-exist")
+	require.Error(t, err)
+}
+
+func TestCollect(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found in PATH")
+	}
+	t.Parallel()
+
+	c, err := NewTestConsole(t)
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	cmd := c.Command("sh", "-c", "echo one; echo two; echo three; exit 3")
+	require.NoError(t, cmd.Start())
+
+	out, err := c.Collect(cmd, 5*time.Second)
+	require.Equal(t, "one\r\ntwo\r\nthree\r\n", out)
+	var exitErr *exec.ExitError
+	require.True(t, errors.As(err, &exitErr), "unexpected error: %v", err)
+	require.Equal(t, 3, exitErr.ExitCode())
+}
+
+func TestCollectTimeout(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found in PATH")
+	}
+	t.Parallel()
+
+	c, err := NewTestConsole(t)
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	cmd := c.Command("sh", "-c", "echo started; sleep 5")
+	require.NoError(t, cmd.Start())
+	defer cmd.Process.Kill()
+
+	out, err := c.Collect(cmd, 200*time.Millisecond)
+	require.Equal(t, "started\r\n", out)
+	require.True(t, errors.Is(err, ErrTimeout), "unexpected error: %v", err)
+}
@@ -0,0 +1,87 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"os"
+	"sync/atomic"
+)
+
+// Stats holds counters of a Console's activity over its lifetime, e.g. to
+// export as metrics.
+type Stats struct {
+	// BytesSent is the number of bytes written to Console's tty by Send and
+	// Write.
+	BytesSent int64
+
+	// BytesReceived is the number of bytes read from Console's tty by Expect
+	// and ReadN.
+	BytesReceived int64
+
+	// ExpectCalls is the number of Expect calls that read from Console's tty,
+	// including those made by helpers such as ExpectString and ExpectEOF.
+	ExpectCalls int64
+
+	// Timeouts is the number of Expect calls that failed with a timeout.
+	Timeouts int64
+
+	// Backpressure is the number of times output read from Console's tty went
+	// unconsumed for longer than the threshold of WithBackpressureThreshold,
+	// e.g. to tell whether SetBufferSize helped.
+	Backpressure int64
+}
+
+// stats holds the counters behind Stats. It is shared by a Console and its
+// clones from With, and updated atomically so that Send and Expect can be
+// called concurrently.
+type stats struct {
+	bytesSent     int64
+	bytesReceived int64
+	expectCalls   int64
+	timeouts      int64
+	backpressure  int64
+}
+
+func (s *stats) sent(n int) {
+	atomic.AddInt64(&s.bytesSent, int64(n))
+}
+
+func (s *stats) received(n int) {
+	atomic.AddInt64(&s.bytesReceived, int64(n))
+}
+
+func (s *stats) backpressured() {
+	atomic.AddInt64(&s.backpressure, 1)
+}
+
+func (s *stats) expected(err error) {
+	atomic.AddInt64(&s.expectCalls, 1)
+	if err != nil && os.IsTimeout(err) {
+		atomic.AddInt64(&s.timeouts, 1)
+	}
+}
+
+// Stats returns a snapshot of the counters of Console's activity. Counters are
+// read individually, so a snapshot taken during a Send or Expect may reflect
+// it only in part.
+func (c *Console) Stats() Stats {
+	return Stats{
+		BytesSent:     atomic.LoadInt64(&c.stats.bytesSent),
+		BytesReceived: atomic.LoadInt64(&c.stats.bytesReceived),
+		ExpectCalls:   atomic.LoadInt64(&c.stats.expectCalls),
+		Timeouts:      atomic.LoadInt64(&c.stats.timeouts),
+		Backpressure:  atomic.LoadInt64(&c.stats.backpressure),
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewTestConsole(t)
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	_, err = c.Tty().WriteString("Hello world")
+	require.NoError(t, err)
+
+	_, err = c.ExpectString("world")
+	require.NoError(t, err)
+
+	_, err = c.Expect(String("Goodbye"), WithTimeout(10*time.Millisecond))
+	require.True(t, os.IsTimeout(err), "unexpected error: %v", err)
+
+	_, err = c.Send("hello\n")
+	require.NoError(t, err)
+
+	// Clones share the counters of Console.
+	_, err = c.With().SendLine("abc")
+	require.NoError(t, err)
+
+	require.Equal(t, Stats{
+		BytesSent:     10,
+		BytesReceived: 11,
+		ExpectCalls:   2,
+		Timeouts:      1,
+	}, c.Stats())
+}
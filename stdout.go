@@ -0,0 +1,197 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"io"
+	"log"
+	"sync"
+)
+
+// StdoutErrorPolicy is what Console does when a writer added by WithStdout
+// returns an error.
+type StdoutErrorPolicy int
+
+const (
+	// StdoutErrorAbort stops the write and returns the error, which aborts
+	// the Expect or read in progress. This is the default.
+	StdoutErrorAbort StdoutErrorPolicy = iota
+
+	// StdoutErrorDrop logs the error and stops writing to the failing writer
+	// for the rest of the Console's life, while the remaining writers and
+	// matching carry on.
+	StdoutErrorDrop
+)
+
+// WithStdoutErrorPolicy sets what Console does when a writer added by
+// WithStdout returns an error. By default the error aborts the Expect, see
+// StdoutErrorAbort.
+func WithStdoutErrorPolicy(policy StdoutErrorPolicy) ConsoleOpt {
+	return func(opts *ConsoleOpts) error {
+		opts.StdoutErrorPolicy = policy
+		return nil
+	}
+}
+
+// WithAsyncStdout writes to the writers added by WithStdout from a separate
+// goroutine, so that a slow writer doesn't slow down Expect, which otherwise
+// writes each rune to every writer as it is read. Output read while a write is
+// in progress is coalesced into the next write. Expect and ReadN wait for all
+// the output they read to be written before returning; an error from a writer
+// is returned by the next of them to return, or the next write, once the
+// writer has been dropped or the output pending for it was discarded, see
+// StdoutErrorPolicy. Output is buffered in memory until written, without
+// bound.
+func WithAsyncStdout() ConsoleOpt {
+	return func(opts *ConsoleOpts) error {
+		opts.AsyncStdout = true
+		return nil
+	}
+}
+
+// stdoutWriter writes to Console's stdouts according to its
+// StdoutErrorPolicy.
+type stdoutWriter struct {
+	mu      sync.Mutex
+	writers []io.Writer
+	policy  StdoutErrorPolicy
+	logger  *log.Logger
+
+	// When async is set, writes are queued in pending and written by a
+	// goroutine that runs while writing is set. err is the error of the last
+	// failed write, until it is returned. cond signals when writing is unset.
+	async   bool
+	queueMu sync.Mutex
+	cond    *sync.Cond
+	pending []byte
+	writing bool
+	err     error
+}
+
+func newStdoutWriter(opts ConsoleOpts) *stdoutWriter {
+	sw := &stdoutWriter{
+		writers: opts.Stdouts,
+		policy:  opts.StdoutErrorPolicy,
+		logger:  opts.Logger,
+		async:   opts.AsyncStdout,
+	}
+	sw.cond = sync.NewCond(&sw.queueMu)
+	return sw
+}
+
+// Write writes p to each writer in turn, or queues it to be written if async
+// is set.
+func (sw *stdoutWriter) Write(p []byte) (int, error) {
+	if !sw.async {
+		return sw.write(p)
+	}
+
+	sw.queueMu.Lock()
+	defer sw.queueMu.Unlock()
+
+	if err := sw.takeErr(); err != nil {
+		return 0, err
+	}
+	sw.pending = append(sw.pending, p...)
+	if !sw.writing {
+		sw.writing = true
+		go sw.drain()
+	}
+	return len(p), nil
+}
+
+// drain writes the pending output until there is none left, then unsets
+// writing.
+func (sw *stdoutWriter) drain() {
+	var chunk []byte
+	for {
+		sw.queueMu.Lock()
+		if len(sw.pending) == 0 {
+			sw.writing = false
+			sw.cond.Broadcast()
+			sw.queueMu.Unlock()
+			return
+		}
+		// The buffers are swapped so that writes queue up while a chunk is
+		// written without allocating.
+		chunk, sw.pending = sw.pending, chunk[:0]
+		sw.queueMu.Unlock()
+
+		_, err := sw.write(chunk)
+		if err != nil {
+			sw.queueMu.Lock()
+			sw.err = err
+			sw.pending = sw.pending[:0]
+			sw.queueMu.Unlock()
+		}
+	}
+}
+
+// Flush waits for the pending output to be written and returns the error of
+// the last failed write since the previous Flush, if any.
+func (sw *stdoutWriter) Flush() error {
+	if !sw.async {
+		return nil
+	}
+
+	sw.queueMu.Lock()
+	defer sw.queueMu.Unlock()
+
+	for sw.writing {
+		sw.cond.Wait()
+	}
+	return sw.takeErr()
+}
+
+// takeErr returns err and clears it. It must be called with queueMu held.
+func (sw *stdoutWriter) takeErr() error {
+	err := sw.err
+	sw.err = nil
+	return err
+}
+
+// write writes p to each writer in turn, like io.MultiWriter, unless they are
+// dropped by the policy.
+func (sw *stdoutWriter) write(p []byte) (int, error) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	var writers []io.Writer
+	for i, w := range sw.writers {
+		n, err := w.Write(p)
+		if err == nil && n != len(p) {
+			err = io.ErrShortWrite
+		}
+		if err == nil {
+			if writers != nil {
+				writers = append(writers, w)
+			}
+			continue
+		}
+
+		if sw.policy == StdoutErrorAbort {
+			return n, err
+		}
+
+		sw.logger.Printf("dropping stdout after failed write: %s", err)
+		if writers == nil {
+			writers = append(make([]io.Writer, 0, len(sw.writers)-1), sw.writers[:i]...)
+		}
+	}
+	if writers != nil {
+		sw.writers = writers
+	}
+	return len(p), nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// slowWriter is an io.Writer that takes delay for each write, like a slow
+// file or network sink.
+type slowWriter struct {
+	mu     sync.Mutex
+	delay  time.Duration
+	buf    bytes.Buffer
+	writes int
+}
+
+func (sw *slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(sw.delay)
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	sw.writes++
+	return sw.buf.Write(p)
+}
+
+func (sw *slowWriter) String() string {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	return sw.buf.String()
+}
+
+func TestWithAsyncStdout(t *testing.T) {
+	t.Parallel()
+
+	stdout := &slowWriter{delay: time.Millisecond}
+	c, err := newTestConsole(t, WithStdout(stdout), WithAsyncStdout())
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	data := strings.Repeat("0123456789", 20) + "end"
+	_, err = c.Tty().WriteString(data)
+	require.NoError(t, err)
+
+	out, err := c.ExpectString("end")
+	require.NoError(t, err)
+	require.Equal(t, data, out)
+
+	// All the output is written by the time Expect returns, in fewer writes
+	// than runes.
+	require.Equal(t, data, stdout.String())
+	require.True(t, stdout.writes < len(data), "expected writes to be coalesced, got %d", stdout.writes)
+
+	_, err = c.Tty().WriteString("abcd")
+	require.NoError(t, err)
+	p, err := c.ReadN(4, time.Second)
+	require.NoError(t, err)
+	require.Equal(t, "abcd", string(p))
+	require.Equal(t, data+"abcd", stdout.String())
+}
+
+func TestWithAsyncStdoutError(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewConsole(WithStdout(errWriter{os.ErrClosed}), WithAsyncStdout(), WithDefaultTimeout(time.Second))
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	_, err = c.Tty().WriteString("Hello world")
+	require.NoError(t, err)
+	// The error may be returned by a write before the condition is met.
+	out, err := c.ExpectString("world")
+	require.Equal(t, os.ErrClosed, err)
+	require.True(t, strings.HasPrefix("Hello world", out), "unexpected output: %q", out)
+}
+
+// BenchmarkStdout measures Expect with a slow stdout, which bounds the speed of
+// matching unless it is written to asynchronously.
+func BenchmarkStdout(b *testing.B) {
+	data := strings.Repeat("0123456789", 10) + "\x00"
+
+	for _, async := range []bool{false, true} {
+		name := "Sync"
+		opts := []ConsoleOpt{WithStdout(&slowWriter{delay: 10 * time.Microsecond})}
+		if async {
+			name = "Async"
+			opts = append(opts, WithAsyncStdout())
+		}
+
+		b.Run(name, func(b *testing.B) {
+			c, err := NewConsole(opts...)
+			require.NoError(b, err)
+			defer c.Close()
+
+			b.SetBytes(int64(len(data)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, err = c.Tty().WriteString(data)
+				require.NoError(b, err)
+				_, err = c.ExpectString("\x00")
+				require.NoError(b, err)
+			}
+		})
+	}
+}
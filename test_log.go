@@ -18,6 +18,7 @@ import (
 	"bufio"
 	"io"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -35,9 +36,19 @@ func NewTestConsole(t *testing.T, opts ...ConsoleOpt) (*Console, error) {
 
 // NewTestWriter returns an io.Writer where bytes written to the file are
 // logged by go's testing logger. Bytes are flushed to the logger on line end.
+//
+// On Go 1.14 and later, logging stops once the test completes, and later
+// writes are dropped, so that a Console outliving its test doesn't panic.
 func NewTestWriter(t *testing.T) (io.Writer, error) {
 	r, w := io.Pipe()
-	tw := testWriter{t}
+	tw := &testWriter{t: t}
+
+	if c, ok := interface{}(t).(cleaner); ok {
+		c.Cleanup(func() {
+			tw.stop()
+			r.Close()
+		})
+	}
 
 	go func() {
 		defer r.Close()
@@ -57,19 +68,59 @@ func NewTestWriter(t *testing.T) (io.Writer, error) {
 		}
 	}()
 
-	return w, nil
+	return &testPipeWriter{w: w, tw: tw}, nil
+}
+
+// cleaner is implemented by testing.T since Go 1.14.
+type cleaner interface {
+	Cleanup(func())
 }
 
 // testWriter provides a io.Writer interface to go's testing logger.
 type testWriter struct {
-	t *testing.T
+	t       *testing.T
+	mu      sync.Mutex
+	stopped bool
 }
 
-func (tw testWriter) Write(p []byte) (n int, err error) {
-	tw.t.Log(string(p))
+func (tw *testWriter) Write(p []byte) (n int, err error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if !tw.stopped {
+		tw.t.Log(string(p))
+	}
 	return len(p), nil
 }
 
+// stop drops writes from now on.
+func (tw *testWriter) stop() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.stopped = true
+}
+
+// isStopped reports whether writes are dropped.
+func (tw *testWriter) isStopped() bool {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	return tw.stopped
+}
+
+// testPipeWriter writes to the pipe of a testWriter until it is stopped, and
+// drops writes afterwards.
+type testPipeWriter struct {
+	w  *io.PipeWriter
+	tw *testWriter
+}
+
+func (tpw *testPipeWriter) Write(p []byte) (int, error) {
+	n, err := tpw.w.Write(p)
+	if err == io.ErrClosedPipe && tpw.tw.isStopped() {
+		return len(p), nil
+	}
+	return n, err
+}
+
 // StripTrailingEmptyLines returns a copy of s stripped of trailing lines that
 // consist of only space characters.
 func StripTrailingEmptyLines(out string) string {
@@ -0,0 +1,43 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTestWriterAfterTest(t *testing.T) {
+	if _, ok := interface{}(t).(cleaner); !ok {
+		t.Skip("testing.T has no Cleanup before Go 1.14")
+	}
+
+	var w io.Writer
+	t.Run("sub", func(t *testing.T) {
+		var err error
+		w, err = NewTestWriter(t)
+		require.NoError(t, err)
+
+		_, err = w.Write([]byte("during test\n"))
+		require.NoError(t, err)
+	})
+
+	// The sub-test has completed, so its logger would panic.
+	n, err := w.Write([]byte("after test\n"))
+	require.NoError(t, err)
+	require.Equal(t, len("after test\n"), n)
+}
@@ -0,0 +1,201 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// TranscriptOutput is the type of transcript events for content read from
+	// Console's tty.
+	TranscriptOutput = "output"
+
+	// TranscriptInput is the type of transcript events for content written to
+	// Console's tty.
+	TranscriptInput = "input"
+)
+
+// TranscriptEvent is an entry in a transcript recorded by WithTranscript.
+type TranscriptEvent struct {
+	Time time.Time `json:"time"`
+	Type string    `json:"type"`
+	Data string    `json:"data"`
+}
+
+// WithTranscript records everything read from and written to Console's tty to
+// w, as one JSON encoded TranscriptEvent per line. Each event is written with
+// a single call to w.Write, so w can split the transcript between events, see
+// RotatingTranscript.
+func WithTranscript(w io.Writer) ConsoleOpt {
+	return func(opts *ConsoleOpts) error {
+		opts.Transcript = w
+		return nil
+	}
+}
+
+// ReadTranscript parses a transcript recorded by WithTranscript.
+func ReadTranscript(r io.Reader) ([]TranscriptEvent, error) {
+	var events []TranscriptEvent
+	dec := json.NewDecoder(r)
+	for {
+		var event TranscriptEvent
+		err := dec.Decode(&event)
+		if err == io.EOF {
+			return events, nil
+		}
+		if err != nil {
+			return events, err
+		}
+		events = append(events, event)
+	}
+}
+
+// transcript records TranscriptEvents to a writer.
+type transcript struct {
+	mu     sync.Mutex
+	w      io.Writer
+	logger *log.Logger
+}
+
+func (t *transcript) record(typ string, p []byte) {
+	if len(p) == 0 {
+		return
+	}
+
+	var buf bytes.Buffer
+	err := json.NewEncoder(&buf).Encode(TranscriptEvent{
+		Time: time.Now(),
+		Type: typ,
+		Data: string(p),
+	})
+	if err != nil {
+		t.logger.Printf("failed to encode transcript event: %s", err)
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, err = t.w.Write(buf.Bytes())
+	if err != nil {
+		t.logger.Printf("failed to write transcript event: %s", err)
+	}
+}
+
+// transcriptReader records the content read from its reader as output.
+type transcriptReader struct {
+	reader     io.Reader
+	transcript *transcript
+}
+
+func (tr *transcriptReader) Read(p []byte) (int, error) {
+	n, err := tr.reader.Read(p)
+	tr.transcript.record(TranscriptOutput, p[:n])
+	return n, err
+}
+
+// RotatingTranscript is a writer for WithTranscript that splits a transcript
+// into segments, starting a new one when the current segment exceeds a size or
+// age. Segments are only split between events, so each segment can be parsed
+// with ReadTranscript on its own.
+type RotatingTranscript struct {
+	mu      sync.Mutex
+	open    func(segment int) (io.WriteCloser, error)
+	maxSize int64
+	maxAge  time.Duration
+	w       io.WriteCloser
+	segment int
+	size    int64
+	opened  time.Time
+	closed  bool
+}
+
+// NewRotatingTranscript returns a RotatingTranscript that calls open to start
+// each segment, numbered from 0. A segment is rotated once it holds at least
+// maxSize bytes or was opened longer than maxAge ago; a zero value disables
+// either limit.
+//
+// Disk usage is bounded by how open names segments, e.g. reusing a fixed set
+// of file names, and may be reduced further by returning a gzip.Writer that
+// closes its file as well.
+func NewRotatingTranscript(open func(segment int) (io.WriteCloser, error), maxSize int64, maxAge time.Duration) *RotatingTranscript {
+	return &RotatingTranscript{
+		open:    open,
+		maxSize: maxSize,
+		maxAge:  maxAge,
+	}
+}
+
+// Write writes p to the current segment, rotating it first if it is full or
+// too old.
+func (rt *RotatingTranscript) Write(p []byte) (int, error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	if rt.closed {
+		return 0, os.ErrClosed
+	}
+
+	if rt.w != nil && rt.full() {
+		err := rt.w.Close()
+		rt.w = nil
+		rt.segment++
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if rt.w == nil {
+		w, err := rt.open(rt.segment)
+		if err != nil {
+			return 0, err
+		}
+		rt.w = w
+		rt.size = 0
+		rt.opened = time.Now()
+	}
+
+	n, err := rt.w.Write(p)
+	rt.size += int64(n)
+	return n, err
+}
+
+// full reports whether the current segment should be rotated.
+func (rt *RotatingTranscript) full() bool {
+	if rt.maxSize > 0 && rt.size >= rt.maxSize {
+		return true
+	}
+	return rt.maxAge > 0 && time.Since(rt.opened) >= rt.maxAge
+}
+
+// Close closes the current segment. Writes after Close return os.ErrClosed.
+func (rt *RotatingTranscript) Close() error {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	rt.closed = true
+	if rt.w == nil {
+		return nil
+	}
+	err := rt.w.Close()
+	rt.w = nil
+	return err
+}
@@ -0,0 +1,89 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"bufio"
+	"log"
+	"strings"
+	"syscall"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/require"
+)
+
+// disableEcho turns off the echo of input on c's tty, as a program does while
+// reading a password.
+func disableEcho(t *testing.T, c *Console) {
+	rc, err := c.Tty().SyscallConn()
+	require.NoError(t, err)
+
+	var errno syscall.Errno
+	require.NoError(t, rc.Control(func(fd uintptr) {
+		var termios syscall.Termios
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TCGETS, uintptr(unsafe.Pointer(&termios)))
+		if errno != 0 {
+			return
+		}
+		termios.Lflag &^= syscall.ECHO
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TCSETS, uintptr(unsafe.Pointer(&termios)))
+	}))
+	require.Zero(t, errno)
+}
+
+func TestWithSendRedactor(t *testing.T) {
+	t.Parallel()
+
+	transcript := new(lockedBuffer)
+	audit := new(lockedBuffer)
+	logs := new(lockedBuffer)
+	c, err := newTestConsole(t,
+		WithLogger(log.New(logs, "", 0)),
+		WithTranscript(transcript),
+		WithAuditLog(audit),
+		WithMirrorSends(),
+		WithStdout(logs),
+		WithSendRedactor(func(s string) string {
+			return strings.Replace(s, "hunter2", "***", -1)
+		}),
+	)
+	require.NoError(t, err)
+	defer testCloser(t, c)
+	disableEcho(t, c)
+
+	_, err = c.Tty().WriteString("Password: ")
+	require.NoError(t, err)
+	_, err = c.ExpectString("Password: ")
+	require.NoError(t, err)
+	_, err = c.SendLine("hunter2")
+	require.NoError(t, err)
+
+	// The program reads the real password.
+	line, err := bufio.NewReader(c.Tty()).ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "hunter2\n", line)
+
+	_, err = c.Tty().WriteString("Welcome\n")
+	require.NoError(t, err)
+	_, err = c.ExpectString("Welcome")
+	require.NoError(t, err)
+
+	require.Contains(t, transcript.String(), `"***\n"`)
+	require.Contains(t, audit.String(), `send "***\n"`)
+	for name, buf := range map[string]*lockedBuffer{"transcript": transcript, "audit log": audit, "log": logs} {
+		require.False(t, strings.Contains(buf.String(), "hunter2"), "%s leaks the password: %q", name, buf.String())
+	}
+}
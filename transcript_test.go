@@ -0,0 +1,94 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// segmentBuffer is an in-memory transcript segment.
+type segmentBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (sb *segmentBuffer) Close() error {
+	sb.closed = true
+	return nil
+}
+
+func TestRotatingTranscript(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var segments []*segmentBuffer
+	rt := NewRotatingTranscript(func(segment int) (io.WriteCloser, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		require.Equal(t, len(segments), segment)
+		sb := new(segmentBuffer)
+		segments = append(segments, sb)
+		return sb, nil
+	}, 64, 0)
+
+	c, err := newTestConsole(t, WithTranscript(rt))
+	require.NoError(t, err)
+
+	_, err = c.SendLine("hello")
+	require.NoError(t, err)
+	_, err = c.Tty().WriteString("What is 1+1?")
+	require.NoError(t, err)
+	_, err = c.ExpectString("What is 1+1?")
+	require.NoError(t, err)
+
+	testCloser(t, c)
+	require.NoError(t, rt.Close())
+
+	_, err = rt.Write([]byte("{}\n"))
+	require.Equal(t, os.ErrClosed, err)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.True(t, len(segments) >= 2, "expected transcript to rotate")
+
+	var input, output strings.Builder
+	for i, sb := range segments {
+		require.True(t, sb.closed, "segment %d not closed", i)
+
+		events, err := ReadTranscript(&sb.Buffer)
+		require.NoError(t, err, "segment %d", i)
+		require.NotEmpty(t, events, "segment %d", i)
+
+		for _, event := range events {
+			switch event.Type {
+			case TranscriptInput:
+				input.WriteString(event.Data)
+			case TranscriptOutput:
+				output.WriteString(event.Data)
+			default:
+				t.Errorf("unexpected event type %q", event.Type)
+			}
+		}
+	}
+	require.Equal(t, "hello\n", input.String())
+	require.Contains(t, output.String(), "What is 1+1?")
+}
@@ -0,0 +1,53 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+// ResizeHook is a function callback that is called after Console's tty is
+// resized by SetWinSize.
+type ResizeHook func(rows, cols uint16)
+
+// WithResizeHook adds ResizeHooks to be notified when Console's tty is
+// resized.
+func WithResizeHook(hooks ...ResizeHook) ConsoleOpt {
+	return func(opts *ConsoleOpts) error {
+		opts.ResizeHooks = append(opts.ResizeHooks, hooks...)
+		return nil
+	}
+}
+
+// SetWinSize sets the window size of Console's tty and sends SIGWINCH to its
+// foreground process group, if any, so that programs redraw for the new size
+// even if the pty layer doesn't signal them. The screen maintained by
+// WithScreen is resized as well.
+func (c *Console) SetWinSize(rows, cols uint16) error {
+	err := setWinSize(c.pts, rows, cols)
+	if err != nil {
+		return err
+	}
+
+	if c.screen != nil {
+		c.screen.resize(int(rows), int(cols))
+	}
+
+	err = signalWinch(c.ptm)
+	if err != nil {
+		c.Logf("failed to signal window size change: %s", err)
+	}
+
+	for _, hook := range c.opts.ResizeHooks {
+		hook(rows, cols)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package expect
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+
+	"github.com/creack/pty"
+)
+
+// setWinSize sets the window size of tty.
+func setWinSize(tty *os.File, rows, cols uint16) error {
+	return pty.Setsize(tty, &pty.Winsize{
+		Rows: rows,
+		Cols: cols,
+	})
+}
+
+// signalWinch sends SIGWINCH to the foreground process group of the tty of the
+// given ptm. A tty that isn't the controlling terminal of any session has no
+// foreground process group, in which case nothing is signaled.
+func signalWinch(ptm *os.File) error {
+	var pgrp int32
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, ptm.Fd(), syscall.TIOCGPGRP, uintptr(unsafe.Pointer(&pgrp)))
+	if errno != 0 || pgrp <= 0 {
+		return nil
+	}
+
+	err := syscall.Kill(-int(pgrp), syscall.SIGWINCH)
+	if err == syscall.ESRCH {
+		return nil
+	}
+	return err
+}
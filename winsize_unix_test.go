@@ -0,0 +1,64 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package expect
+
+import (
+	"os/exec"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetWinSize(t *testing.T) {
+	for _, name := range []string{"sh", "stty", "sleep"} {
+		if _, err := exec.LookPath(name); err != nil {
+			t.Skipf("%s not found in PATH", name)
+		}
+	}
+	t.Parallel()
+
+	var resized [][2]uint16
+	c, err := newTestConsole(t, WithResizeHook(func(rows, cols uint16) {
+		resized = append(resized, [2]uint16{rows, cols})
+	}))
+	require.NoError(t, err)
+	defer testCloser(t, c)
+
+	// The program reports its size on SIGWINCH, which requires the tty to be
+	// its controlling terminal.
+	cmd := exec.Command("sh", "-c", `trap 'echo "size $(stty size)"' WINCH; echo ready; while :; do sleep 0.05; done`)
+	cmd.Stdin = c.Tty()
+	cmd.Stdout = c.Tty()
+	cmd.Stderr = c.Tty()
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+	require.NoError(t, cmd.Start())
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	_, err = c.ExpectString("ready")
+	require.NoError(t, err)
+
+	require.NoError(t, c.SetWinSize(30, 100))
+	_, err = c.ExpectString("size 30 100")
+	require.NoError(t, err)
+
+	require.Equal(t, [][2]uint16{{30, 100}}, resized)
+}
@@ -0,0 +1,34 @@
+// Copyright 2018 Netflix, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows
+// +build windows
+
+package expect
+
+import (
+	"os"
+
+	"github.com/creack/pty"
+)
+
+// setWinSize is unsupported, as there are no ptys on Windows.
+func setWinSize(tty *os.File, rows, cols uint16) error {
+	return pty.ErrUnsupported
+}
+
+// signalWinch is a no-op, as there are no signals to deliver on Windows.
+func signalWinch(ptm *os.File) error {
+	return nil
+}